@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+//newAPIServer creates a new http.Server serving the status and control API of the given Runner
+func newAPIServer(addr string, r *Runner) *http.Server {
+	a := &apiServer{r: r}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", a.get(a.status))
+	mux.HandleFunc("/api/plots", a.get(a.plots))
+	mux.HandleFunc("/api/dirs", a.get(a.dirs))
+	mux.HandleFunc("/api/history", a.get(a.history))
+	mux.HandleFunc("/api/pause", a.post(a.pause))
+	mux.HandleFunc("/api/resume", a.post(a.resume))
+	mux.HandleFunc("/api/drain", a.post(a.drain))
+	mux.HandleFunc("/api/kill", a.post(a.kill))
+	mux.HandleFunc("/api/plot", a.post(a.plot))
+	mux.HandleFunc("/api/reload", a.post(a.reload))
+	mux.HandleFunc("/metrics", metricsHandler(r))
+	return &http.Server{
+		Addr:    addr,
+		Handler: mux,
+	}
+}
+
+//apiServer implements the handlers of the status and control API
+type apiServer struct {
+	r *Runner
+}
+
+//apiHandler handles an API request returning the value to respond with as JSON
+type apiHandler func(req *http.Request) (interface{}, int, error)
+
+//get wraps an apiHandler that only accepts GET requests
+func (a *apiServer) get(h apiHandler) http.HandlerFunc {
+	return a.handle(http.MethodGet, h)
+}
+
+//post wraps an apiHandler that only accepts POST requests
+func (a *apiServer) post(h apiHandler) http.HandlerFunc {
+	return a.handle(http.MethodPost, h)
+}
+
+func (a *apiServer) handle(method string, h apiHandler) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, apiError(fmt.Errorf("method %s not allowed", req.Method)))
+			return
+		}
+		v, code, err := h(req)
+		if err != nil {
+			writeJSON(w, code, apiError(err))
+			return
+		}
+		writeJSON(w, code, v)
+	}
+}
+
+//apiError returns the JSON body of an error response
+func apiError(err error) map[string]string {
+	return map[string]string{"Error": err.Error()}
+}
+
+//writeJSON writes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		logErrLn("could not write API response:", err)
+	}
+}
+
+func (a *apiServer) status(*http.Request) (interface{}, int, error) {
+	return a.r.Status(), http.StatusOK, nil
+}
+
+func (a *apiServer) plots(*http.Request) (interface{}, int, error) {
+	return a.r.Tracker.All(), http.StatusOK, nil
+}
+
+func (a *apiServer) dirs(*http.Request) (interface{}, int, error) {
+	st := a.r.Status()
+	return map[string][]DirStatus{
+		"PlotDirs": st.PlotDirs,
+		"FarmDirs": st.FarmDirs,
+	}, http.StatusOK, nil
+}
+
+func (a *apiServer) history(*http.Request) (interface{}, int, error) {
+	return a.r.History(), http.StatusOK, nil
+}
+
+func (a *apiServer) pause(*http.Request) (interface{}, int, error) {
+	a.r.Pause()
+	return a.r.Status(), http.StatusOK, nil
+}
+
+func (a *apiServer) resume(*http.Request) (interface{}, int, error) {
+	a.r.Resume()
+	return a.r.Status(), http.StatusOK, nil
+}
+
+func (a *apiServer) drain(*http.Request) (interface{}, int, error) {
+	a.r.Drain()
+	return a.r.Status(), http.StatusOK, nil
+}
+
+func (a *apiServer) reload(*http.Request) (interface{}, int, error) {
+	if err := a.r.Reload(); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	return a.r.Status(), http.StatusOK, nil
+}
+
+func (a *apiServer) kill(req *http.Request) (interface{}, int, error) {
+	pid, err := strconv.Atoi(req.URL.Query().Get("pid"))
+	if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid pid: %v", err)
+	}
+	if err = a.r.KillPlot(pid); err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	return map[string]int{"Killed": pid}, http.StatusOK, nil
+}
+
+func (a *apiServer) plot(*http.Request) (interface{}, int, error) {
+	err := a.r.plot()
+	if err != nil && canRetry(err) {
+		return nil, http.StatusConflict, err
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return a.r.Status(), http.StatusAccepted, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAPIServer(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{MaxParallelPlots: 2, StateFile: t.TempDir() + "/state.json"})
+
+	r := newRunner()
+	srv := httptest.NewServer(newAPIServer("", r).Handler)
+	defer srv.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{http.MethodGet, "/api/status", http.StatusOK},
+		{http.MethodGet, "/api/plots", http.StatusOK},
+		{http.MethodGet, "/api/pause", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/pause", http.StatusOK},
+		{http.MethodPost, "/api/plot", http.StatusConflict},
+		{http.MethodPost, "/api/kill?pid=abc", http.StatusBadRequest},
+		{http.MethodPost, "/api/kill?pid=999999", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code {
+			t.Errorf("%s %s: expected status %d, got %d", tt.method, tt.path, tt.code, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/api/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var st RunnerStatus
+	if err = json.NewDecoder(resp.Body).Decode(&st); err != nil {
+		t.Fatal(err)
+	}
+	if !st.Paused || st.MaxParallelPlots != 2 || st.LastRefusal != ErrPaused.Error() {
+		t.Errorf("unexpected status %+v", st)
+	}
+}
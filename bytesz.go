@@ -101,26 +101,41 @@ func ByteSzFromGiB(gb float64) ByteSz {
 
 // MemStats represents memory statistics for darwin
 type MemStats struct {
-	Total, Used, Cached, Free, Active, Inactive, SwapTotal, SwapUsed, SwapFree ByteSz
+	Total, Used, Cached, Free, Available, Active, Inactive, SwapTotal, SwapUsed, SwapFree ByteSz
 }
 
 //getMemStats gets a MemStats ptr with sizes in ByteSz
 func getMemStats() *MemStats {
-	mem, err := memory.Get()
+	mem, err := memStats()
 	if err != nil {
 		panic(err)
 	}
+	return mem
+}
+
+//memStats gets a MemStats ptr with sizes in ByteSz or an error if memory stats can not be read
+func memStats() (*MemStats, error) {
+	mem, err := memory.Get()
+	if err != nil {
+		return nil, err
+	}
+	available := mem.Available
+	if !mem.MemAvailableEnabled {
+		// kernels without MemAvailable: free memory plus what can be reclaimed from caches
+		available = mem.Free + mem.Buffers + mem.Cached
+	}
 	return &MemStats{
 		Total:     ByteSz(mem.Total),
 		Used:      ByteSz(mem.Used),
 		Cached:    ByteSz(mem.Cached),
 		Free:      ByteSz(mem.Free),
+		Available: ByteSz(available),
 		Active:    ByteSz(mem.Active),
 		Inactive:  ByteSz(mem.Inactive),
 		SwapTotal: ByteSz(mem.SwapTotal),
 		SwapUsed:  ByteSz(mem.SwapUsed),
 		SwapFree:  ByteSz(mem.SwapFree),
-	}
+	}, nil
 }
 
 // DiskStat contains the disk stat details
@@ -130,12 +145,12 @@ type DiskStat struct {
 	Total     ByteSz
 }
 
-//diskStat gets the free disk space as a ByteSz for the given dir
-func diskStat(dir string) *DiskStat {
+//statFS gets the disk space of the file system of the given dir or an error if it can not be read
+func statFS(dir string) (*DiskStat, error) {
 	var stat unix.Statfs_t
 
 	if err := unix.Statfs(dir, &stat); err != nil {
-		logFatalF("could not get disk status of %s: %v", dir, err)
+		return nil, err
 	}
 
 	ds := &DiskStat{
@@ -145,5 +160,5 @@ func diskStat(dir string) *DiskStat {
 
 	ds.Used = ds.Total.Sub(ds.Available)
 
-	return ds
+	return ds, nil
 }
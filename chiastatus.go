@@ -0,0 +1,275 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const chiaStatusMaxAge = time.Minute
+
+var (
+	reSize       = regexp.MustCompile(`^([\d.]+)\s*([KMGTPE]?i?B)`)
+	reDuration   = regexp.MustCompile(`(\d+) (year|month|week|day|hour|minute)s?`)
+	reWalletID   = regexp.MustCompile(`^Wallet ID (\d+) type (\S+)\s*(.*)$`)
+	reWalletBal  = regexp.MustCompile(`^\s*-([A-Za-z ]+): ([\d.]+) (\w+) \((\d+) mojo\)`)
+	reHarvesters = regexp.MustCompile(`^Plot count( for all harvesters)?: (\d+)`)
+
+	sizeUnits = map[string]float64{
+		"B":   1,
+		"KiB": math.Pow(1024, 1),
+		"MiB": math.Pow(1024, 2),
+		"GiB": math.Pow(1024, 3),
+		"TiB": math.Pow(1024, 4),
+		"PiB": math.Pow(1024, 5),
+		"EiB": math.Pow(1024, 6),
+	}
+
+	durationUnits = map[string]time.Duration{
+		"minute": time.Minute,
+		"hour":   time.Hour,
+		"day":    24 * time.Hour,
+		"week":   7 * 24 * time.Hour,
+		"month":  30 * 24 * time.Hour,
+		"year":   365 * 24 * time.Hour,
+	}
+)
+
+//FarmSummary is the parsed output of `chia farm summary`
+type FarmSummary struct {
+	FarmingStatus     string
+	Farming           bool
+	TotalFarmed       float64
+	UserFees          float64
+	BlockRewards      float64
+	LastHeightFarmed  int
+	PlotCount         int
+	TotalSize         ByteSz
+	NetworkSpace      float64
+	ExpectedTimeToWin string
+	TimeToWin         time.Duration
+}
+
+//WalletBalance is the balance of a single wallet in the output of `chia wallet show`
+type WalletBalance struct {
+	ID               int
+	Type             string
+	Name             string
+	Unit             string
+	TotalMojo        uint64
+	PendingTotalMojo uint64
+	SpendableMojo    uint64
+}
+
+//WalletStatus is the parsed output of `chia wallet show`
+type WalletStatus struct {
+	Height      int
+	SyncStatus  string
+	Synced      bool
+	Fingerprint int64
+	Wallets     []WalletBalance
+}
+
+//parseSize parses a size such as "11.878 TiB" to bytes
+func parseSize(s string) (float64, error) {
+	m := reSize.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	unit, ok := sizeUnits[m[2]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit %q", m[2])
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	return f * unit, nil
+}
+
+//parseTimeToWin parses a duration such as "1 year and 2 months", returning 0 if it is unknown
+func parseTimeToWin(s string) time.Duration {
+	var d time.Duration
+	for _, m := range reDuration.FindAllStringSubmatch(s, -1) {
+		n, _ := strconv.Atoi(m[1])
+		d += time.Duration(n) * durationUnits[m[2]]
+	}
+	return d
+}
+
+//splitField splits a "Key: value" line
+func splitField(line string) (string, string, bool) {
+	i := strings.Index(line, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
+
+//parseFarmSummary parses the output of `chia farm summary`
+func parseFarmSummary(out []byte) (*FarmSummary, error) {
+	fs := new(FarmSummary)
+	found := false
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if m := reHarvesters.FindStringSubmatch(line); m != nil {
+			fs.PlotCount, _ = strconv.Atoi(m[2])
+			continue
+		}
+		key, val, ok := splitField(line)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Farming status":
+			found = true
+			fs.FarmingStatus = val
+			fs.Farming = val == "Farming"
+		case "Total chia farmed":
+			fs.TotalFarmed, _ = strconv.ParseFloat(val, 64)
+		case "User transaction fees":
+			fs.UserFees, _ = strconv.ParseFloat(val, 64)
+		case "Block rewards":
+			fs.BlockRewards, _ = strconv.ParseFloat(val, 64)
+		case "Last height farmed":
+			fs.LastHeightFarmed, _ = strconv.Atoi(val)
+		case "Total size of plots":
+			if size, err := parseSize(val); err == nil {
+				fs.TotalSize = ByteSz(size)
+			}
+		case "Estimated network space":
+			fs.NetworkSpace, _ = parseSize(val)
+		case "Expected time to win":
+			fs.ExpectedTimeToWin = val
+			fs.TimeToWin = parseTimeToWin(val)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no farming status in farm summary")
+	}
+	return fs, sc.Err()
+}
+
+//parseWalletShow parses the output of `chia wallet show`
+func parseWalletShow(out []byte) (*WalletStatus, error) {
+	ws := new(WalletStatus)
+	found := false
+	var wallet *WalletBalance
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if m := reWalletID.FindStringSubmatch(line); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			ws.Wallets = append(ws.Wallets, WalletBalance{
+				ID:   id,
+				Type: m[2],
+				Name: strings.TrimSpace(m[3]),
+			})
+			wallet = &ws.Wallets[len(ws.Wallets)-1]
+			continue
+		}
+		if m := reWalletBal.FindStringSubmatch(line); m != nil && wallet != nil {
+			mojo, _ := strconv.ParseUint(m[4], 10, 64)
+			wallet.Unit = m[3]
+			switch m[1] {
+			case "Total Balance":
+				wallet.TotalMojo = mojo
+			case "Pending Total Balance":
+				wallet.PendingTotalMojo = mojo
+			case "Spendable":
+				wallet.SpendableMojo = mojo
+			}
+			continue
+		}
+		key, val, ok := splitField(line)
+		if !ok {
+			continue
+		}
+		switch key {
+		case "Wallet height":
+			found = true
+			ws.Height, _ = strconv.Atoi(val)
+		case "Sync status":
+			ws.SyncStatus = val
+			ws.Synced = val == "Synced"
+		case "Balances, fingerprint":
+			ws.Fingerprint, _ = strconv.ParseInt(val, 10, 64)
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("no wallet height in wallet show output")
+	}
+	return ws, sc.Err()
+}
+
+//mojoString formats mojos as XCH
+func mojoString(mojo uint64) string {
+	return strconv.FormatFloat(float64(mojo)/1e12, 'f', -1, 64) + " XCH"
+}
+
+//String returns a human readable summary of the farm
+func (fs *FarmSummary) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Farming status:\t%s\n", fs.FarmingStatus)
+	fmt.Fprintf(&buf, "Total chia farmed:\t%g\n", fs.TotalFarmed)
+	fmt.Fprintf(&buf, "Last height farmed:\t%d\n", fs.LastHeightFarmed)
+	fmt.Fprintf(&buf, "Plot count:\t%d\n", fs.PlotCount)
+	fmt.Fprintf(&buf, "Total size of plots:\t%.3f TiB\n", float64(fs.TotalSize)/sizeUnits["TiB"])
+	fmt.Fprintf(&buf, "Estimated network space:\t%.3f EiB\n", fs.NetworkSpace/sizeUnits["EiB"])
+	fmt.Fprintf(&buf, "Expected time to win:\t%s\n", fs.ExpectedTimeToWin)
+	return buf.String()
+}
+
+//String returns a human readable summary of the wallets
+func (ws *WalletStatus) String() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Wallet height:\t%d\n", ws.Height)
+	fmt.Fprintf(&buf, "Sync status:\t%s\n", ws.SyncStatus)
+	fmt.Fprintf(&buf, "Fingerprint:\t%d\n", ws.Fingerprint)
+	for _, w := range ws.Wallets {
+		fmt.Fprintf(&buf, "Wallet %d (%s) balance:\t%s (spendable %s, pending %s)\n", w.ID, w.Type,
+			mojoString(w.TotalMojo), mojoString(w.SpendableMojo), mojoString(w.PendingTotalMojo))
+	}
+	return buf.String()
+}
+
+//ChiaStatus is the parsed farm summary and wallet status, along with any errors getting them
+type ChiaStatus struct {
+	Farm        *FarmSummary  `json:",omitempty"`
+	FarmError   string        `json:",omitempty"`
+	Wallet      *WalletStatus `json:",omitempty"`
+	WalletError string        `json:",omitempty"`
+	Time        time.Time
+}
+
+//getChiaStatus runs `chia farm summary` and `chia wallet show` and parses their output
+func getChiaStatus() ChiaStatus {
+	st := ChiaStatus{Time: time.Now()}
+	if out, err := FarmSummaryCmd().Output(); err != nil {
+		st.FarmError = err.Error()
+	} else if st.Farm, err = parseFarmSummary(out); err != nil {
+		st.FarmError = err.Error()
+	}
+	if out, err := WalletShowCmd().Output(); err != nil {
+		st.WalletError = err.Error()
+	} else if st.Wallet, err = parseWalletShow(out); err != nil {
+		st.WalletError = err.Error()
+	}
+	return st
+}
+
+//ChiaStatus returns the farm summary and wallet status, refreshing them if they are older than a minute
+func (r *Runner) ChiaStatus() ChiaStatus {
+	r.chiaMu.Lock()
+	defer r.chiaMu.Unlock()
+	if time.Since(r.chiaStatus.Time) > chiaStatusMaxAge {
+		r.chiaStatus = getChiaStatus()
+	}
+	return r.chiaStatus
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseFarmSummary(t *testing.T) {
+	size := ByteSz(11.878 * sizeUnits["TiB"])
+	tests := []struct {
+		file      string
+		status    string
+		farming   bool
+		farmed    float64
+		height    int
+		plots     int
+		size      ByteSz
+		timeToWin time.Duration
+	}{
+		{"testdata/farm_summary_1.1.7.txt", "Farming", true, 2, 345678, 120, size, 425 * 24 * time.Hour},
+		{"testdata/farm_summary_1.2.11.txt", "Farming", true, 0.25, 1012345, 120, size, 1060 * 24 * time.Hour},
+		{"testdata/farm_summary_not_synced.txt", "Not synced or not connected to peers", false, 0, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		b, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fs, err := parseFarmSummary(b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if fs.FarmingStatus != tt.status || fs.Farming != tt.farming {
+			t.Errorf("%s: expected status %q, got %q", tt.file, tt.status, fs.FarmingStatus)
+		}
+		if fs.TotalFarmed != tt.farmed {
+			t.Errorf("%s: expected %g chia farmed, got %g", tt.file, tt.farmed, fs.TotalFarmed)
+		}
+		if fs.LastHeightFarmed != tt.height {
+			t.Errorf("%s: expected last height %d, got %d", tt.file, tt.height, fs.LastHeightFarmed)
+		}
+		if fs.PlotCount != tt.plots {
+			t.Errorf("%s: expected %d plots, got %d", tt.file, tt.plots, fs.PlotCount)
+		}
+		if fs.TotalSize != tt.size {
+			t.Errorf("%s: expected total size %s, got %s", tt.file, tt.size, fs.TotalSize)
+		}
+		if fs.TimeToWin != tt.timeToWin {
+			t.Errorf("%s: expected time to win %s, got %s", tt.file, tt.timeToWin, fs.TimeToWin)
+		}
+	}
+
+	if _, err := parseFarmSummary([]byte("Connection error. Check if full node is running")); err == nil {
+		t.Error("expected an error parsing invalid farm summary")
+	}
+}
+
+func TestParseWalletShow(t *testing.T) {
+	tests := []struct {
+		file    string
+		height  int
+		synced  bool
+		wallets []WalletBalance
+	}{
+		{"testdata/wallet_show_1.1.7.txt", 345670, true, []WalletBalance{
+			{ID: 1, Type: "STANDARD_WALLET", Unit: "xch", TotalMojo: 2000000000000, PendingTotalMojo: 2000000000000, SpendableMojo: 2000000000000},
+		}},
+		{"testdata/wallet_show_1.2.11.txt", 1012340, true, []WalletBalance{
+			{ID: 1, Type: "STANDARD_WALLET", Name: "Chia Wallet", Unit: "xch", TotalMojo: 250000000000, PendingTotalMojo: 250000000000, SpendableMojo: 200000000000},
+			{ID: 2, Type: "POOLING_WALLET", Name: "Pool wallet", Unit: "xch"},
+		}},
+		{"testdata/wallet_show_syncing.txt", 1200, false, []WalletBalance{
+			{ID: 1, Type: "STANDARD_WALLET", Unit: "xch"},
+		}},
+	}
+	for _, tt := range tests {
+		b, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ws, err := parseWalletShow(b)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if ws.Height != tt.height || ws.Synced != tt.synced || ws.Fingerprint != 1234567890 {
+			t.Errorf("%s: unexpected wallet status %+v", tt.file, ws)
+		}
+		if len(ws.Wallets) != len(tt.wallets) {
+			t.Fatalf("%s: expected %d wallets, got %d", tt.file, len(tt.wallets), len(ws.Wallets))
+		}
+		for i, w := range tt.wallets {
+			if ws.Wallets[i] != w {
+				t.Errorf("%s: expected wallet %+v, got %+v", tt.file, w, ws.Wallets[i])
+			}
+		}
+	}
+}
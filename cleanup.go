@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	StaleTempIgnore = "ignore"
+	StaleTempReport = "report"
+	StaleTempDelete = "delete"
+)
+
+//plotTempFiles returns the temp files of the plot with the given plot ID in the given dirs
+func plotTempFiles(plotID string, dirs ...string) []string {
+	if len(plotID) == 0 {
+		return nil
+	}
+	var files []string
+	for _, d := range dirs {
+		if len(d) == 0 {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(d, "*"+plotID+"*.tmp"))
+		if err != nil {
+			continue
+		}
+		files = append(files, matches...)
+	}
+	return files
+}
+
+//filesSize returns the total size of the given files
+func filesSize(files []string) ByteSz {
+	var total ByteSz
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			total = total.Add(ByteSz(fi.Size()))
+		}
+	}
+	return total
+}
+
+//removeFiles removes the given files and returns the total size removed
+func removeFiles(files []string) ByteSz {
+	var removed ByteSz
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if err = os.Remove(f); err != nil {
+			logErrF("could not remove temp file %s: %v\n", f, err)
+			continue
+		}
+		removed = removed.Add(ByteSz(fi.Size()))
+	}
+	return removed
+}
+
+//cleanupPlot removes the temp files of a failed or killed plot from its temp and farm dirs
+func cleanupPlot(pid int, plotID string, dirs ...string) {
+	if len(plotID) == 0 {
+		logErrF("[%d] plot id unknown, temp files can not be cleaned up\n", pid)
+		return
+	}
+	files := plotTempFiles(plotID, dirs...)
+	removed := removeFiles(files)
+	logF("[%d] removed %d temp files of plot %s freeing %s\n", pid, len(files), plotID, removed)
+}
+
+//staleTempFiles returns the plot temp files in the given dirs that do not belong to any of the given plot IDs
+func staleTempFiles(ownedIDs []string, dirs ...string) []string {
+	var stale []string
+	for _, d := range dirs {
+		if len(d) == 0 {
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(d, "plot-*.tmp"))
+		if err != nil {
+			continue
+		}
+	matchLoop:
+		for _, f := range matches {
+			for _, id := range ownedIDs {
+				if strings.Contains(filepath.Base(f), id) {
+					continue matchLoop
+				}
+			}
+			stale = append(stale, f)
+		}
+	}
+	sort.Strings(stale)
+	return stale
+}
+
+//sweepStaleTempFiles finds plot temp files in all plot and farm dirs that are not owned by any tracked plot
+// and reports or deletes them according to the StaleTempPolicy
+func (r *Runner) sweepStaleTempFiles() {
+	env := getEnv()
+	if env.StaleTempPolicy == StaleTempIgnore {
+		return
+	}
+
+	r.mu.RLock()
+	states := make(map[int]PlotState, len(r.states))
+	for pid, st := range r.states {
+		states[pid] = st
+	}
+	r.mu.RUnlock()
+
+	// the temp files of a plot with an unknown plot ID can not be told apart from stale ones, so its dirs are skipped
+	var owned []string
+	skip := map[string]bool{}
+	for _, p := range r.Tracker.All() {
+		if len(p.PlotID) > 0 {
+			owned = append(owned, p.PlotID)
+			continue
+		}
+		st, ok := states[p.PID]
+		if !ok {
+			logErrF("[%d] plot id and dirs unknown, skipping stale temp file sweep\n", p.PID)
+			return
+		}
+		logErrF("[%d] plot id unknown, skipping stale temp file sweep of %s\n", p.PID, st.TempDir)
+		skip[st.TempDir], skip[st.TempDir2], skip[st.FarmDir] = true, true, true
+	}
+
+	var all []string
+	for _, p := range r.PlotPool.Dirs() {
+		all = append(all, p.dirStr)
+	}
+	for _, f := range r.FarmPool.Dirs() {
+		all = append(all, f.dirStr)
+	}
+	if r.staging != nil {
+		all = append(all, r.staging.dirStr)
+	}
+	all = append(all, secondTempDirs(env)...)
+	var dirs []string
+	for _, d := range all {
+		if !skip[d] {
+			dirs = append(dirs, d)
+		}
+	}
+
+	stale := staleTempFiles(owned, dirs...)
+	if len(stale) == 0 {
+		return
+	}
+
+	var (
+		buf   bytes.Buffer
+		total ByteSz
+	)
+	for _, f := range stale {
+		var size ByteSz
+		if fi, err := os.Stat(f); err == nil {
+			size = ByteSz(fi.Size())
+		}
+		total = total.Add(size)
+		fmt.Fprintf(&buf, "\t%s\t%s\n", f, size)
+	}
+
+	if env.StaleTempPolicy == StaleTempDelete {
+		removed := removeFiles(stale)
+		logF("removed %d stale temp files freeing %s:\n%s", len(stale), removed, buf.String())
+		Notify(EventStaleTemp, 0, "stale temp files removed",
+			fmt.Sprintf("removed %d stale temp files freeing %s:\n\n%s", len(stale), removed, buf.String()))
+		return
+	}
+
+	logErrF("found %d stale temp files using %s:\n%s", len(stale), total, buf.String())
+	Notify(EventStaleTemp, 0, "stale temp files found",
+		fmt.Sprintf("found %d stale temp files using %s:\n\n%s\n"+
+			"set StaleTempPolicy = \"delete\" to remove them automatically", len(stale), total, buf.String()))
+}
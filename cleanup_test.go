@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestTempFiles(t *testing.T) {
+	const (
+		owned = "3f5a1e0e2d5c9b0fbd6b0b4b3f9c8b2c6a3d8e1f0a9b7c6d5e4f3a2b1c0d9e8f"
+		other = "8c4f6d1e2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5"
+	)
+	tmpDir, farmDir := t.TempDir(), t.TempDir()
+	files := []string{
+		filepath.Join(tmpDir, "plot-k32-2021-05-12-10-00-"+owned+".plot.p2.t1.sort_bucket_000.tmp"),
+		filepath.Join(tmpDir, "plot-k32-2021-05-12-10-00-"+owned+".plot.table1.tmp"),
+		filepath.Join(farmDir, "plot-k32-2021-05-12-10-00-"+owned+".plot.2.tmp"),
+		filepath.Join(tmpDir, "plot-k32-2021-05-11-08-00-"+other+".plot.table1.tmp"),
+		filepath.Join(farmDir, "plot-k32-2021-05-10-08-00-"+other+".plot"),
+	}
+	for _, f := range files {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := plotTempFiles(owned, tmpDir, "", farmDir)
+	if !reflect.DeepEqual(got, files[:3]) {
+		t.Errorf("expected temp files %v, got %v", files[:3], got)
+	}
+
+	stale := staleTempFiles([]string{owned}, tmpDir, farmDir)
+	if !reflect.DeepEqual(stale, files[3:4]) {
+		t.Errorf("expected stale files %v, got %v", files[3:4], stale)
+	}
+
+	if removed := removeFiles(got); removed != 3 {
+		t.Errorf("expected 3 B removed, got %s", removed)
+	}
+	if left := plotTempFiles(owned, tmpDir, farmDir); len(left) != 0 {
+		t.Errorf("expected no temp files left, got %v", left)
+	}
+}
+
+func TestSweepStaleTempFiles(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{StaleTempPolicy: StaleTempDelete, StateFile: t.TempDir() + "/state.json"})
+
+	busyDir, idleDir := t.TempDir(), t.TempDir()
+	busy := filepath.Join(busyDir, "plot-k32-2021-05-12-10-00-aaaa.plot.table1.tmp")
+	stale := filepath.Join(idleDir, "plot-k32-2021-05-11-08-00-bbbb.plot.table1.tmp")
+	for _, f := range []string{busy, stale} {
+		if err := os.WriteFile(f, []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := newRunner()
+	r.PlotPool.AddDirs(newPlotDir(busyDir, bladebitPlotter{}), newPlotDir(idleDir, bladebitPlotter{}))
+	// the plot just started in busyDir, its plot ID is not known yet
+	r.states[1] = PlotState{PID: 1, TempDir: busyDir}
+	r.Tracker.Add(1, newPlotProgress(bladebitPlotter{}))
+	r.sweepStaleTempFiles()
+
+	if _, err := os.Stat(busy); err != nil {
+		t.Errorf("expected the temp file in the dir of the plot without plot ID to be kept, got %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("expected the stale temp file in the other dir to be removed, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+//plotDirConfig is a [[plot_dir]] table of the config, the settings it leaves at 0 or empty use the global settings
+type plotDirConfig struct {
+	// Path is the plot dir or a glob pattern of plot dirs
+	Path string `toml:"path"`
+	// MaxConcurrent is the max number of plots running in the dir, 0 for no limit
+	MaxConcurrent int `toml:"max_concurrent"`
+	// Threads is the number of threads per plot
+	Threads int `toml:"threads"`
+	// MemMB is the memory per plot in MB
+	MemMB int `toml:"mem_mb"`
+	// SecondTempDir is the second temp dir passed to the plotter with -2
+	SecondTempDir string `toml:"second_temp_dir"`
+	// Plotter is the plotter backend to use
+	Plotter string `toml:"plotter"`
+	// FarmerPublicKey is the farmer public key plots are created with
+	FarmerPublicKey string `toml:"farmer_public_key"`
+	// PoolPublicKey is the pool public key solo plots are created with
+	PoolPublicKey string `toml:"pool_public_key"`
+	// PoolContractAddress is the pool contract address pool plots are created with
+	PoolContractAddress string `toml:"pool_contract_address"`
+	// Fingerprint selects the key of the chia keychain plots are created with
+	Fingerprint int `toml:"fingerprint"`
+}
+
+//Keys returns the keys plots in the dir are created with
+func (c plotDirConfig) Keys() PlotKeys {
+	return PlotKeys{
+		FarmerPublicKey:     c.FarmerPublicKey,
+		PoolPublicKey:       c.PoolPublicKey,
+		PoolContractAddress: c.PoolContractAddress,
+		Fingerprint:         c.Fingerprint,
+	}
+}
+
+//farmDirConfig is a [[farm_dir]] table of the config
+type farmDirConfig struct {
+	// Path is the farm dir or a glob pattern of farm dirs
+	Path string `toml:"path"`
+	// Priority is the weight of the dir for the weighted strategy, 0 for the default of 1
+	Priority int `toml:"priority"`
+	// ReserveGB is the space in GB that is kept free in the dir
+	ReserveGB int `toml:"reserve_gb"`
+	// MaxConcurrentCopies is the max number of running plots that copy their final plot file into the dir, along with
+	// the plots moved into it from the staging dir, 0 for no limit
+	MaxConcurrentCopies int `toml:"max_concurrent_copies"`
+}
+
+//appendDir appends the dir to the list if it is not in it yet
+func appendDir(dirs []string, dir string) []string {
+	for _, d := range dirs {
+		if d == dir {
+			return dirs
+		}
+	}
+	return append(dirs, dir)
+}
+
+//applyDirConfigs adds the dirs of the [[plot_dir]] and [[farm_dir]] tables to PlotDirs and FarmDirs and their
+// settings to the per dir setting maps, the tables take precedence over the flat settings of the same dir
+func applyDirConfigs(e *envVars, errs *configErrors) {
+	for _, c := range e.PlotDirConfigs {
+		if len(c.Path) == 0 {
+			errs.add("plot_dir without a path")
+			continue
+		}
+		e.PlotDirs = appendDir(e.PlotDirs, c.Path)
+		if len(c.Plotter) > 0 {
+			if e.PlotDirPlotters == nil {
+				e.PlotDirPlotters = map[string]string{}
+			}
+			e.PlotDirPlotters[c.Path] = c.Plotter
+		}
+		if c.MaxConcurrent != 0 {
+			if e.DirMaxConcurrent == nil {
+				e.DirMaxConcurrent = map[string]int{}
+			}
+			e.DirMaxConcurrent[c.Path] = c.MaxConcurrent
+		}
+		if c.Threads < 0 {
+			errs.add("invalid threads %d for plot_dir %s", c.Threads, c.Path)
+		}
+		if c.MemMB < 0 {
+			errs.add("invalid mem_mb %d for plot_dir %s", c.MemMB, c.Path)
+		}
+	}
+
+	for _, c := range e.FarmDirConfigs {
+		if len(c.Path) == 0 {
+			errs.add("farm_dir without a path")
+			continue
+		}
+		e.FarmDirs = appendDir(e.FarmDirs, c.Path)
+		if c.Priority != 0 {
+			if e.DirPriorities == nil {
+				e.DirPriorities = map[string]int{}
+			}
+			e.DirPriorities[c.Path] = c.Priority
+		}
+		if c.MaxConcurrentCopies != 0 {
+			if e.DirMaxConcurrent == nil {
+				e.DirMaxConcurrent = map[string]int{}
+			}
+			e.DirMaxConcurrent[c.Path] = c.MaxConcurrentCopies
+		}
+		if c.ReserveGB < 0 {
+			errs.add("invalid reserve_gb %d for farm_dir %s", c.ReserveGB, c.Path)
+		}
+	}
+}
+
+//PlotDirSettings returns the settings of the [[plot_dir]] table applying to the given plot dir
+// the settings the table does not set, or all if there is no table for the dir, are the global settings
+func (e *envVars) PlotDirSettings(dir string) plotDirConfig {
+	c := plotDirConfig{Path: dir}
+	keys := make([]string, len(e.PlotDirConfigs))
+	for i, pc := range e.PlotDirConfigs {
+		keys[i] = pc.Path
+	}
+	if k, ok := dirKey(dir, keys); ok {
+		for _, pc := range e.PlotDirConfigs {
+			if pc.Path == k {
+				c = pc
+				c.Path = dir
+				break
+			}
+		}
+	}
+	if c.Threads == 0 {
+		c.Threads = e.PerPlotThreads
+	}
+	if c.MemMB == 0 {
+		c.MemMB = e.PerPlotMemMB
+	}
+	if len(c.SecondTempDir) == 0 {
+		c.SecondTempDir = e.TempDir2
+	}
+	if len(c.FarmerPublicKey) == 0 {
+		c.FarmerPublicKey = e.FarmerPublicKey
+	}
+	// a table setting either the pool key or the pool contract makes its plots solo or pool plots on its own
+	if len(c.PoolPublicKey) == 0 && len(c.PoolContractAddress) == 0 {
+		c.PoolPublicKey = e.PoolPublicKey
+		c.PoolContractAddress = e.PoolContractAddress
+	}
+	if c.Fingerprint == 0 {
+		c.Fingerprint = e.Fingerprint
+	}
+	c.Plotter = plotterName(e, dir)
+	c.MaxConcurrent = dirInt(e.DirMaxConcurrent, dir, 0)
+	return c
+}
+
+//FarmDirReserve returns the space that is kept free in the given farm dir
+func (e *envVars) FarmDirReserve(dir string) ByteSz {
+	keys := make([]string, len(e.FarmDirConfigs))
+	for i, fc := range e.FarmDirConfigs {
+		keys[i] = fc.Path
+	}
+	if k, ok := dirKey(dir, keys); ok {
+		for _, fc := range e.FarmDirConfigs {
+			if fc.Path == k {
+				return ByteSzFromGiB(float64(fc.ReserveGB))
+			}
+		}
+	}
+	return 0
+}
+
+//secondTempDirs returns the second temp dirs of the global config and of all [[plot_dir]] tables
+func secondTempDirs(e *envVars) []string {
+	var dirs []string
+	if len(e.TempDir2) > 0 {
+		dirs = append(dirs, e.TempDir2)
+	}
+	for _, c := range e.PlotDirConfigs {
+		if len(c.SecondTempDir) > 0 {
+			dirs = appendDir(dirs, c.SecondTempDir)
+		}
+	}
+	return dirs
+}
+
+//plotMemory returns the memory a plot uses at its peak when it is started with the given memory setting
+// only the chia plotter takes the setting, the others use a fixed amount
+func plotMemory(plotter Plotter, memMB int) ByteSz {
+	if plotter.Name() == PlotterChia && memMB > 0 {
+		return ByteSzFromMB(float64(memMB))
+	}
+	return plotter.Memory()
+}
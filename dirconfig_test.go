@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirConfigs(t *testing.T) {
+	tmp := t.TempDir()
+	prevConfigFile := flagConfigFile
+	defer func() { flagConfigFile = prevConfigFile }()
+	flagConfigFile = filepath.Join(tmp, "config.toml")
+
+	header := testConfig(t, tmp, "nvme", "sata1", "sata2", "tmp2", "farm", "usb")
+	dir := func(d string) string {
+		return filepath.Join(tmp, d)
+	}
+	config := fmt.Sprintf(`MaxParallelPlots = 4
+PerPlotThreads = 2
+PerPlotMemMB = 3400
+PlotDirs = [%q]
+FarmDirs = [%q]
+
+[[plot_dir]]
+path = %q
+threads = 8
+mem_mb = 6000
+second_temp_dir = %q
+max_concurrent = 3
+
+[[plot_dir]]
+path = %q
+plotter = "bladebit"
+max_concurrent = 1
+
+[[farm_dir]]
+path = %q
+priority = 2
+reserve_gb = 50
+max_concurrent_copies = 1
+`, dir("nvme"), dir("farm"), dir("nvme"), dir("tmp2"), dir("sata*"), dir("usb"))
+	if err := os.WriteFile(flagConfigFile, []byte(header+config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := readEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the flat lists are kept and the table dirs are added once
+	if got := fmt.Sprint(discoverPlotDirs(e)); got != fmt.Sprint([]string{dir("nvme"), dir("sata1"), dir("sata2")}) {
+		t.Errorf("unexpected plot dirs %s", got)
+	}
+	if got := fmt.Sprint(discoverFarmDirs(e)); got != fmt.Sprint([]string{dir("farm"), dir("usb")}) {
+		t.Errorf("unexpected farm dirs %s", got)
+	}
+
+	tests := []struct {
+		dir    string
+		expect plotDirConfig
+	}{
+		{dir("nvme"), plotDirConfig{Path: dir("nvme"), MaxConcurrent: 3, Threads: 8, MemMB: 6000,
+			SecondTempDir: dir("tmp2"), Plotter: PlotterBladebit}},
+		{dir("sata2"), plotDirConfig{Path: dir("sata2"), MaxConcurrent: 1, Threads: 2, MemMB: 3400,
+			Plotter: PlotterBladebit}},
+	}
+	for _, tt := range tests {
+		if got := e.PlotDirSettings(tt.dir); got != tt.expect {
+			t.Errorf("%s: expected %+v, got %+v", tt.dir, tt.expect, got)
+		}
+	}
+
+	if p := e.PlotDirPlotters[dir("sata*")]; p != PlotterBladebit {
+		t.Errorf("expected the plotter of the table to be set for its dirs, got %q", p)
+	}
+	if r := e.FarmDirReserve(dir("usb")); r != ByteSzFromGiB(50) {
+		t.Errorf("expected 50GiB kept free, got %s", r)
+	}
+	if r := e.FarmDirReserve(dir("farm")); r != 0 {
+		t.Errorf("expected no space kept free, got %s", r)
+	}
+	if p := dirInt(e.DirPriorities, dir("usb"), 1); p != 2 {
+		t.Errorf("expected priority 2, got %d", p)
+	}
+	if max := dirInt(e.DirMaxConcurrent, dir("usb"), 0); max != 1 {
+		t.Errorf("expected max 1 concurrent copy, got %d", max)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"sync"
+	"time"
 )
 
 //newDir creates a new dir with the given dir string
@@ -9,80 +10,236 @@ func newDir(dirStr string) dir {
 	return dir{
 		dirStr:     dirStr,
 		mu:         &sync.RWMutex{},
-		activePIDs: map[int]int{},
+		activePIDs: map[int]string{},
+		health:     HealthHealthy,
+		stat:       statFS,
 	}
 }
 
 //dir represents a dir
 type dir struct {
-	dirStr     string
-	activePIDs map[int]int
-	mu         *sync.RWMutex
+	dirStr       string
+	activePIDs   map[int]string
+	draining     bool
+	health       Health
+	healthReason string
+	ioErr        string
+	ioErrAt      time.Time
+	probedAt     time.Time
+	lastUsed     time.Time
+	stat         statFunc
+	mu           *sync.RWMutex
 }
 
-//newPlotDir crates anew PlotDir with the given dir string
-func newPlotDir(dirStr string) *PlotDir {
+//newPlotDir crates anew PlotDir with the given dir string and Plotter
+func newPlotDir(dirStr string, plotter Plotter) *PlotDir {
 	return &PlotDir{
-		dir: newDir(dirStr),
+		dir:     newDir(dirStr),
+		plotter: plotter,
 	}
 }
 
+//PIDs returns the active PIDs using the dir
+func (d *dir) PIDs() []int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	pids := make([]int, 0, len(d.activePIDs))
+	for pid := range d.activePIDs {
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+//SetPlotID sets the plot ID of the plot with the given PID once it is known, so the files it writes in the dir
+// can be found
+func (d *dir) SetPlotID(pid int, plotID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.activePIDs[pid]; ok {
+		d.activePIDs[pid] = plotID
+	}
+}
+
+//reserved returns the space the running plots still need in the dir to reach their peak footprint of peak each
+// the files a plot has already written in the dir take up part of its footprint and are deducted from its
+// reservation, plots with an unknown plot ID reserve their whole footprint
+func (d *dir) reserved(peak ByteSz) ByteSz {
+	d.mu.RLock()
+	ids := make([]string, 0, len(d.activePIDs))
+	for _, id := range d.activePIDs {
+		ids = append(ids, id)
+	}
+	d.mu.RUnlock()
+	var total ByteSz
+	for _, id := range ids {
+		if written := filesSize(plotTempFiles(id, d.dirStr)); written < peak {
+			total = total.Add(peak.Sub(written))
+		}
+	}
+	return total
+}
+
+//SetDraining sets whether the dir is draining
+// a draining dir gets no new plots, it is removed from its pool once its running plots are done
+func (d *dir) SetDraining(draining bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = draining
+}
+
+//Draining returns true if the dir gets no new plots
+func (d *dir) Draining() bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.draining
+}
+
+//DiskStat returns the disk space of the dir
+// if the file system can not be read the dir is marked offline and an empty DiskStat is returned
 func (d *dir) DiskStat() *DiskStat {
-	return diskStat(d.dirStr)
+	stat, err := d.stat(d.dirStr)
+	if err != nil {
+		d.setHealth(HealthOffline, err.Error())
+		return &DiskStat{}
+	}
+	return stat
 }
 
 //PlotDir represents a dir used for plotting
 type PlotDir struct {
 	dir
+	plotter Plotter
+	// pending is the plotter replacing plotter once the running plots are done, the dir gets no new plots until then
+	pending Plotter
+}
+
+//Plotter returns the plotter creating the plots in the dir
+func (p *PlotDir) Plotter() Plotter {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.plotter
+}
+
+//SetPlotter replaces the plotter creating the plots in the dir, false is returned if the dir has running plots
+// the temp space of the running plots is accounted for with the plotter they were started with, so the plotter
+// is only replaced once they are done and the dir gets no new plots until then
+func (p *PlotDir) SetPlotter(plotter Plotter) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending = nil
+	if plotter.Name() == p.plotter.Name() {
+		return true
+	}
+	if len(p.activePIDs) > 0 {
+		p.pending = plotter
+		return false
+	}
+	p.plotter = plotter
+	return true
+}
+
+//PlotterPending returns true if the plotter of the dir is replaced once its running plots are done
+func (p *PlotDir) PlotterPending() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.pending != nil
 }
 
 //AddPID adds the given PID int to the active pid map
 func (p *PlotDir) AddPID(pid int) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.activePIDs[pid] = pid
+	p.activePIDs[pid] = ""
 }
 
+//RmPID removes the given PID int in the active pid map, a pending plotter replaces the plotter of the dir once
+// the last running plot is removed
 func (p *PlotDir) RmPID(pid int) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 	delete(p.activePIDs, pid)
+	pending := p.pending
+	if pending != nil && len(p.activePIDs) == 0 {
+		p.plotter, p.pending = pending, nil
+	}
+	p.mu.Unlock()
+	if pending != nil && !p.PlotterPending() {
+		logF("plot directory %s now uses plotter %s\n", p.dirStr, pending.Name())
+	}
 }
 
-func (p *PlotDir) TempSpace() ByteSz {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	return ByteSz(int64(len(p.activePIDs)) * TmpPlotSpace.B())
+//Reserved returns the temp space the running plots still need in the plot dir
+func (p *PlotDir) Reserved() ByteSz {
+	return p.reserved(p.Plotter().TempSpace())
 }
 
 func (p *PlotDir) AvailableSpace() ByteSz {
-	return diskStat(p.dirStr).Available
+	return p.DiskStat().Available
 }
 
 func (p *PlotDir) PlottingSpaceAvail() ByteSz {
-	return p.AvailableSpace().Sub(p.TempSpace())
+	return p.AvailableSpace().Sub(p.Reserved())
 }
 
 func (p *PlotDir) CanPlot() bool {
-	return p.PlottingSpaceAvail() > TmpPlotSpace
+	return p.PlottingSpaceAvail() > p.Plotter().TempSpace()
 }
 
 func NewFarmDir(dir string) *FarmDir {
 	return &FarmDir{
-		dir: newDir(dir),
+		dir:   newDir(dir),
+		moves: map[string]ByteSz{},
 	}
 }
 
 //FarmDir represents a dir used for farming
 type FarmDir struct {
 	dir
+	// moves maps the .tmp files of the plots being moved into the dir to the size of their plot
+	moves map[string]ByteSz
+	// replaceable is the space of the plots in the dir that may be deleted to make room for new plots
+	replaceable ByteSz
+}
+
+//setReplaceable sets the space of the replaceable plots in the dir
+func (f *FarmDir) setReplaceable(space ByteSz) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.replaceable = space
+}
+
+//Replaceable returns the space of the plots in the dir that may be deleted to make room for new plots
+func (f *FarmDir) Replaceable() ByteSz {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.replaceable
+}
+
+//writing returns the space the running plots that are copying their final plot file into the dir still need,
+// leaving out the plot with the given ID
+func (f *FarmDir) writing(exceptID string) ByteSz {
+	f.mu.RLock()
+	ids := make([]string, 0, len(f.activePIDs))
+	for _, id := range f.activePIDs {
+		if len(id) > 0 && id != exceptID {
+			ids = append(ids, id)
+		}
+	}
+	f.mu.RUnlock()
+	var total ByteSz
+	for _, id := range ids {
+		files := plotTempFiles(id, f.dirStr)
+		if written := filesSize(files); len(files) > 0 && written < FarmPlotSpace {
+			total = total.Add(FarmPlotSpace.Sub(written))
+		}
+	}
+	return total
 }
 
 //AddPID adds the given PID int to the active pid map
 func (f *FarmDir) AddPID(pid int) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	f.activePIDs[pid] = pid
+	f.activePIDs[pid] = ""
 }
 
 //RmPID removes the given PID int in the active pid map
@@ -92,18 +249,65 @@ func (f *FarmDir) RmPID(pid int) {
 	delete(f.activePIDs, pid)
 }
 
-func (f *FarmDir) TempSpace() ByteSz {
+//addMove adds a plot of the given size that is moved into the dir through the given .tmp file
+func (f *FarmDir) addMove(tmpFile string, size ByteSz) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.moves[tmpFile] = size
+}
+
+//rmMove removes the move through the given .tmp file
+func (f *FarmDir) rmMove(tmpFile string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.moves, tmpFile)
+}
+
+//Moves returns the number of plots being moved into the dir
+func (f *FarmDir) Moves() int {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
-	return ByteSz(int64(len(f.activePIDs)) * int64(FarmPlotSpace))
+	return len(f.moves)
+}
+
+//movesReserved returns the space the plots being moved into the dir still need
+func (f *FarmDir) movesReserved() ByteSz {
+	f.mu.RLock()
+	moves := make(map[string]ByteSz, len(f.moves))
+	for tmp, size := range f.moves {
+		moves[tmp] = size
+	}
+	f.mu.RUnlock()
+	var total ByteSz
+	for tmp, size := range moves {
+		if written := filesSize([]string{tmp}); written < size {
+			total = total.Add(size.Sub(written))
+		}
+	}
+	return total
+}
+
+//busy returns true if the farm dir has reached its max number of concurrent plots and moves
+// every plot assigned to the dir counts from its start, as the plots copy their final plot file into it at the end
+// and could otherwise all copy at once
+func (f *FarmDir) busy(e *envVars) bool {
+	max := dirInt(e.DirMaxConcurrent, f.dirStr, 0)
+	return max > 0 && len(f.PIDs())+f.Moves() >= max
+}
+
+//Reserved returns the space the running plots and moves still need in the farm dir for their final plot files,
+// along with the space that is kept free in the dir
+func (f *FarmDir) Reserved() ByteSz {
+	return f.reserved(FarmPlotSpace).Add(f.movesReserved()).Add(getEnv().FarmDirReserve(f.dirStr))
 }
 
 func (f *FarmDir) AvailableSpace() ByteSz {
-	return diskStat(f.dirStr).Available
+	return f.DiskStat().Available
 }
 
+//FarmingSpaceAvail returns the space in the dir for new plots, including the space of the replaceable plots
 func (f *FarmDir) FarmingSpaceAvail() ByteSz {
-	return f.AvailableSpace().Sub(f.TempSpace())
+	return f.AvailableSpace().Add(f.Replaceable()).Sub(f.Reserved())
 }
 
 func (f *FarmDir) CanAddPlot() bool {
@@ -111,9 +315,10 @@ func (f *FarmDir) CanAddPlot() bool {
 }
 
 type PlotPool struct {
-	PlotDirs []*PlotDir
-	ptr      int
-	mu       *sync.RWMutex
+	PlotDirs     []*PlotDir
+	strategy     selectStrategy
+	strategyName string
+	mu           *sync.RWMutex
 }
 
 func (p *PlotPool) AddDirs(plotDirs ...*PlotDir) {
@@ -124,40 +329,117 @@ func (p *PlotPool) AddDirs(plotDirs ...*PlotDir) {
 	}
 }
 
+//Remove removes the PlotDir with the given dir string from the pool
+func (p *PlotPool) Remove(dirStr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, pl := range p.PlotDirs {
+		if pl.dirStr == dirStr {
+			p.PlotDirs = append(p.PlotDirs[:i:i], p.PlotDirs[i+1:]...)
+			return
+		}
+	}
+}
+
+//Find returns the PlotDir with the given dir string or nil if it is not in the pool
+func (p *PlotPool) Find(dirStr string) *PlotDir {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	for _, pl := range p.PlotDirs {
+		if pl.dirStr == dirStr {
+			return pl
+		}
+	}
+	return nil
+}
+
+//Dirs returns the PlotDirs in the pool
+func (p *PlotPool) Dirs() []*PlotDir {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	out := make([]*PlotDir, len(p.PlotDirs))
+	copy(out, p.PlotDirs)
+	return out
+}
+
 func (p *PlotPool) DirCnt() int {
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 	return len(p.PlotDirs)
 }
 
-func (p *PlotPool) next() *PlotDir {
+//SetStrategy sets the strategy the next plot dir is selected with, the state of the current strategy is kept
+// if it is not changed
+func (p *PlotPool) SetStrategy(name string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	if len(p.PlotDirs) < 1 {
-		logFatalLn("no plot dirs")
+	if p.strategy != nil && p.strategyName == name {
+		return
 	}
-	newPtr := p.ptr + 1
-	if newPtr > len(p.PlotDirs)-1 {
-		newPtr = 0
+	p.strategy = newSelectStrategy(name)
+	p.strategyName = name
+}
+
+//order returns the order the candidates are tried in by the strategy of the pool
+func (p *PlotPool) order(cands []dirCandidate) []int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.strategy == nil {
+		p.strategy = newSelectStrategy(p.strategyName)
 	}
-	p.ptr = newPtr
-	return p.PlotDirs[newPtr]
+	return p.strategy.Order(cands)
 }
 
-func (p *PlotPool) NextUp() (*PlotDir, error) {
-	for i := 0; i < p.DirCnt(); i++ {
-		pl := p.next()
-		if pl.CanPlot() {
-			return pl, nil
+//selected tells the strategy of the pool which candidate was selected
+func (p *PlotPool) selected(cands []dirCandidate, i int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.strategy.Selected(cands, i)
+}
+
+//NextUp returns the next PlotDir with enough space that is accepted by the given accept func
+// the dirs are tried in the order of the selection strategy, draining, unhealthy and busy dirs and the dirs
+// waiting for their plotter to be replaced are skipped
+// if a dir has space but is not accepted, an ErrStaggered error is returned
+func (p *PlotPool) NextUp(accept func(*PlotDir) bool) (*PlotDir, error) {
+	env := getEnv()
+	dirs := p.Dirs()
+	cands := make([]dirCandidate, len(dirs))
+	for i, pl := range dirs {
+		cands[i] = pl.candidate(env, pl.PlottingSpaceAvail())
+	}
+	staggered, busy := false, false
+	for _, i := range p.order(cands) {
+		pl := dirs[i]
+		if pl.Draining() || pl.PlotterPending() || !pl.Healthy() || cands[i].Free <= pl.Plotter().TempSpace() {
+			continue
+		}
+		if pl.busy(env) {
+			busy = true
+			continue
 		}
+		if accept != nil && !accept(pl) {
+			staggered = true
+			continue
+		}
+		p.selected(cands, i)
+		pl.used()
+		return pl, nil
+	}
+	if staggered {
+		return nil, ErrStaggered
+	}
+	if busy {
+		return nil, ErrDirsBusy
 	}
 	return nil, ErrMaxProcessesReached
 }
 
 type FarmPool struct {
-	FarmDirs []*FarmDir
-	ptr      int
-	mu       *sync.RWMutex
+	FarmDirs     []*FarmDir
+	strategy     selectStrategy
+	strategyName string
+	mu           *sync.RWMutex
 }
 
 func (f *FarmPool) AddDirs(farmDirs ...*FarmDir) {
@@ -168,32 +450,107 @@ func (f *FarmPool) AddDirs(farmDirs ...*FarmDir) {
 	}
 }
 
+//Remove removes the FarmDir with the given dir string from the pool
+func (f *FarmPool) Remove(dirStr string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, fd := range f.FarmDirs {
+		if fd.dirStr == dirStr {
+			f.FarmDirs = append(f.FarmDirs[:i:i], f.FarmDirs[i+1:]...)
+			return
+		}
+	}
+}
+
+//Find returns the FarmDir with the given dir string or nil if it is not in the pool
+func (f *FarmPool) Find(dirStr string) *FarmDir {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for _, fd := range f.FarmDirs {
+		if fd.dirStr == dirStr {
+			return fd
+		}
+	}
+	return nil
+}
+
+//Dirs returns the FarmDirs in the pool
+func (f *FarmPool) Dirs() []*FarmDir {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	out := make([]*FarmDir, len(f.FarmDirs))
+	copy(out, f.FarmDirs)
+	return out
+}
+
 func (f *FarmPool) DirCnt() int {
 	f.mu.RLock()
 	defer f.mu.RUnlock()
 	return len(f.FarmDirs)
 }
 
-func (f *FarmPool) next() *FarmDir {
+//SetStrategy sets the strategy the next farm dir is selected with, the state of the current strategy is kept
+// if it is not changed
+func (f *FarmPool) SetStrategy(name string) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
-	if len(f.FarmDirs) < 1 {
-		logFatalLn("no farm dirs")
+	if f.strategy != nil && f.strategyName == name {
+		return
 	}
-	newPtr := f.ptr + 1
-	if newPtr > len(f.FarmDirs)-1 {
-		newPtr = 0
+	f.strategy = newSelectStrategy(name)
+	f.strategyName = name
+}
+
+//order returns the order the candidates are tried in by the strategy of the pool
+func (f *FarmPool) order(cands []dirCandidate) []int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.strategy == nil {
+		f.strategy = newSelectStrategy(f.strategyName)
 	}
-	f.ptr = newPtr
-	return f.FarmDirs[newPtr]
+	return f.strategy.Order(cands)
 }
 
-func (f *FarmPool) NextUp() (*FarmDir, error) {
-	for i := 0; i < f.DirCnt(); i++ {
-		fd := f.next()
-		if fd.CanAddPlot() {
-			return fd, nil
+//selected tells the strategy of the pool which candidate was selected
+func (f *FarmPool) selected(cands []dirCandidate, i int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.strategy.Selected(cands, i)
+}
+
+//NextUp returns the next FarmDir with space for another plot that is accepted by the given accept func
+// the dirs are tried in the order of the selection strategy, draining, unhealthy and busy dirs are skipped
+// if a dir has space but is not accepted, an ErrStaggered error is returned
+func (f *FarmPool) NextUp(accept func(*FarmDir) bool) (*FarmDir, error) {
+	env := getEnv()
+	dirs := f.Dirs()
+	cands := make([]dirCandidate, len(dirs))
+	for i, fd := range dirs {
+		cands[i] = fd.candidate(env, fd.FarmingSpaceAvail())
+	}
+	staggered, busy := false, false
+	for _, i := range f.order(cands) {
+		fd := dirs[i]
+		if fd.Draining() || !fd.Healthy() || cands[i].Free <= FarmPlotSpace {
+			continue
+		}
+		if fd.busy(env) {
+			busy = true
+			continue
+		}
+		if accept != nil && !accept(fd) {
+			staggered = true
+			continue
 		}
+		f.selected(cands, i)
+		fd.used()
+		return fd, nil
+	}
+	if staggered {
+		return nil, ErrStaggered
+	}
+	if busy {
+		return nil, ErrDirsBusy
 	}
 	return nil, ErrMaxProcessesReached
-}
\ No newline at end of file
+}
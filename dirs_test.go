@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReserved(t *testing.T) {
+	tmp := t.TempDir()
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{})
+	fd := NewFarmDir(tmp)
+	stats := fakeStats{tmp: FarmPlotSpace * 3}
+	fd.stat = stats.stat
+
+	fd.AddPID(1)
+	fd.AddPID(2)
+	if r := fd.Reserved(); r != FarmPlotSpace*2 {
+		t.Errorf("expected %s reserved, got %s", FarmPlotSpace*2, r)
+	}
+
+	// the part of the plot that was already copied is no longer reserved
+	written := ByteSzFromGiB(40)
+	f, err := os.Create(filepath.Join(tmp, "plot-k32-2021-06-01-10-00-abcdef.plot.2.tmp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = f.Truncate(written.B()); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	fd.SetPlotID(1, "abcdef")
+	if r := fd.Reserved(); r != FarmPlotSpace*2-written {
+		t.Errorf("expected %s reserved, got %s", FarmPlotSpace*2-written, r)
+	}
+	if st := fd.Status(); st.PlotsAvailable != 1 || st.Reserved != FarmPlotSpace*2-written {
+		t.Errorf("expected 1 plot available with %s reserved, got %d with %s",
+			FarmPlotSpace*2-written, st.PlotsAvailable, st.Reserved)
+	}
+
+	fd.RmPID(1)
+	fd.SetPlotID(1, "abcdef")
+	if r := fd.Reserved(); r != FarmPlotSpace {
+		t.Errorf("expected %s reserved after the plot finished, got %s", FarmPlotSpace, r)
+	}
+
+	// the space kept free in the dir is reserved too
+	setEnv(&envVars{FarmDirConfigs: []farmDirConfig{{Path: tmp, ReserveGB: 10}}})
+	if r := fd.Reserved(); r != FarmPlotSpace+ByteSzFromGiB(10) {
+		t.Errorf("expected %s reserved with 10GiB kept free, got %s", FarmPlotSpace+ByteSzFromGiB(10), r)
+	}
+}
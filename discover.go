@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mountInfoPath = "/proc/self/mountinfo"
+	labelDir      = "/dev/disk/by-label"
+)
+
+//mountScanConfig configures which mounted file systems are used as farm dirs
+type mountScanConfig struct {
+	// MountPoints are glob patterns of the mount points to use
+	MountPoints []string
+	// Labels are glob patterns of the labels of the file systems to use
+	Labels []string
+	// SubDir is the dir within a matching file system plots are farmed from, empty for its root
+	SubDir string
+}
+
+//Enabled returns true if any mount point or label rule is configured
+func (m mountScanConfig) Enabled() bool {
+	return len(m.MountPoints) > 0 || len(m.Labels) > 0
+}
+
+//mountInfo is a single mounted file system as listed in /proc/self/mountinfo
+type mountInfo struct {
+	MountPoint string
+	FSType     string
+	Source     string
+}
+
+//isPattern returns true if the path contains glob meta characters
+func isPattern(p string) bool {
+	return strings.ContainsAny(p, "*?[")
+}
+
+//resolveDirs resolves the glob patterns in the given dirs to the existing dirs matching them
+// dirs that are not patterns are returned as they are
+func resolveDirs(dirs []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(d string) {
+		if !seen[d] {
+			seen[d] = true
+			out = append(out, d)
+		}
+	}
+	for _, d := range dirs {
+		if !isPattern(d) {
+			add(d)
+			continue
+		}
+		matches, err := filepath.Glob(d)
+		if err != nil {
+			logErrF("invalid dir pattern %s: %v\n", d, err)
+			continue
+		}
+		for _, m := range matches {
+			if fi, err := os.Stat(m); err == nil && fi.IsDir() {
+				add(m)
+			}
+		}
+	}
+	return out
+}
+
+//unescapeMountInfo decodes the octal escapes used for spaces and other special characters in mountinfo fields
+func unescapeMountInfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+//parseMountInfo parses the mounted file systems from the format of /proc/self/mountinfo
+func parseMountInfo(r io.Reader) ([]mountInfo, error) {
+	var mounts []mountInfo
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		// the optional fields end with a single - followed by the file system type and the mount source
+		sep := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				sep = i
+				break
+			}
+		}
+		if len(fields) < 5 || sep < 0 || sep+2 >= len(fields) {
+			continue
+		}
+		mounts = append(mounts, mountInfo{
+			MountPoint: unescapeMountInfo(fields[4]),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountInfo(fields[sep+2]),
+		})
+	}
+	return mounts, sc.Err()
+}
+
+//unescapeLabel decodes the \xHH escapes used in the names of /dev/disk/by-label
+func unescapeLabel(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.HasPrefix(s[i:], `\x`) && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+//deviceLabels returns the file system labels by device path
+func deviceLabels() map[string]string {
+	labels := map[string]string{}
+	links, _ := filepath.Glob(filepath.Join(labelDir, "*"))
+	for _, l := range links {
+		dev, err := filepath.EvalSymlinks(l)
+		if err != nil {
+			continue
+		}
+		labels[dev] = unescapeLabel(filepath.Base(l))
+	}
+	return labels
+}
+
+//matchMounts returns the farm dirs of the mounts that match the mount point or label rules
+func matchMounts(mounts []mountInfo, labels map[string]string, cfg mountScanConfig) []string {
+	var dirs []string
+	for _, m := range mounts {
+		match := false
+		for _, p := range cfg.MountPoints {
+			if ok, _ := filepath.Match(p, m.MountPoint); ok {
+				match = true
+			}
+		}
+		if label, ok := labels[m.Source]; ok {
+			for _, p := range cfg.Labels {
+				if ok, _ := filepath.Match(p, label); ok {
+					match = true
+				}
+			}
+		}
+		if match {
+			dirs = append(dirs, filepath.Join(m.MountPoint, cfg.SubDir))
+		}
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+//mountedFarmDirs returns the farm dirs of the currently mounted file systems matching the mount scan rules
+// the SubDir must exist on a file system for it to be used
+func mountedFarmDirs(cfg mountScanConfig) []string {
+	f, err := os.Open(mountInfoPath)
+	if err != nil {
+		logErrLn("could not read mounts:", err)
+		return nil
+	}
+	defer f.Close()
+	mounts, err := parseMountInfo(f)
+	if err != nil {
+		logErrLn("could not read mounts:", err)
+		return nil
+	}
+	var dirs []string
+	for _, d := range matchMounts(mounts, deviceLabels(), cfg) {
+		if fi, err := os.Stat(d); err == nil && fi.IsDir() {
+			dirs = append(dirs, d)
+		}
+	}
+	return dirs
+}
+
+//discoverPlotDirs returns the plot dirs of the env with the glob patterns resolved
+func discoverPlotDirs(e *envVars) []string {
+	return resolveDirs(e.PlotDirs)
+}
+
+//discoverFarmDirs returns the farm dirs of the env with the glob patterns resolved, along with the dirs of the
+// mounted file systems matching the mount scan rules
+func discoverFarmDirs(e *envVars) []string {
+	dirs := e.FarmDirs
+	if e.MountScan.Enabled() {
+		dirs = append(append([]string{}, dirs...), mountedFarmDirs(e.MountScan)...)
+	}
+	return resolveDirs(dirs)
+}
+
+//scanDirs periodically discovers the plot and farm dirs again, adding new dirs to the pools and draining
+// the dirs that are gone
+func (r *Runner) scanDirs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		r.mu.Lock()
+		r.syncDirs(getEnv())
+		r.mu.Unlock()
+	}
+}
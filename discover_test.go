@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	f, err := os.Open("testdata/mountinfo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	mounts, err := parseMountInfo(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mounts) != 6 {
+		t.Fatalf("expected 6 mounts, got %d", len(mounts))
+	}
+	expected := mountInfo{MountPoint: "/media/chia/USB DRIVE", FSType: "exfat", Source: "/dev/sdd1"}
+	if mounts[4] != expected {
+		t.Errorf("expected %+v, got %+v", expected, mounts[4])
+	}
+
+	labels := map[string]string{
+		"/dev/sdd1":      "FARM 3",
+		"/dev/nvme0n1p1": "scratch",
+	}
+	cfg := mountScanConfig{MountPoints: []string{"/mnt/farm*"}, Labels: []string{"FARM*"}, SubDir: "plots"}
+	dirs := matchMounts(mounts, labels, cfg)
+	expectedDirs := []string{"/media/chia/USB DRIVE/plots", "/mnt/farm1/plots", "/mnt/farm2/plots"}
+	if !reflect.DeepEqual(dirs, expectedDirs) {
+		t.Errorf("expected dirs %v, got %v", expectedDirs, dirs)
+	}
+
+	if l := unescapeLabel(`FARM\x203`); l != "FARM 3" {
+		t.Errorf("expected label %q, got %q", "FARM 3", l)
+	}
+}
+
+func TestResolveDirs(t *testing.T) {
+	tmp := t.TempDir()
+	for _, d := range []string{"farm1/plots", "farm2/plots", "farm3"} {
+		if err := os.MkdirAll(filepath.Join(tmp, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "farm3", "plots"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs := resolveDirs([]string{
+		filepath.Join(tmp, "farm*", "plots"),
+		filepath.Join(tmp, "farm1", "plots"),
+		"/mnt/missing",
+	})
+	expected := []string{filepath.Join(tmp, "farm1", "plots"), filepath.Join(tmp, "farm2", "plots"), "/mnt/missing"}
+	if !reflect.DeepEqual(dirs, expected) {
+		t.Errorf("expected dirs %v, got %v", expected, dirs)
+	}
+
+	e := &envVars{
+		Plotter:         PlotterChia,
+		PlotDirPlotters: map[string]string{"/mnt/nvme*": PlotterMadmax, "/mnt/nvme2": PlotterBladebit},
+	}
+	for dir, name := range map[string]string{
+		"/mnt/nvme1": PlotterMadmax,
+		"/mnt/nvme2": PlotterBladebit,
+		"/mnt/ssd1":  PlotterChia,
+	} {
+		if got := plotterName(e, dir); got != name {
+			t.Errorf("expected plotter %s for %s, got %s", name, dir, got)
+		}
+	}
+}
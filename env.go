@@ -5,8 +5,11 @@ import (
 	"github.com/BurntSushi/toml"
 	"math"
 	"os"
+	"os/exec"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 type envVars struct {
@@ -24,6 +27,96 @@ type envVars struct {
 	PerPlotMemMB     int
 	PerPlotThreads   int
 	MaxParallelPlots int
+	// MaxPhase1Plots is the max number of plots allowed in phase 1 at the same time, 0 for no limit
+	MaxPhase1Plots int
+	// MinStartGapMinutes is the minimum number of minutes between 2 plot starts
+	MinStartGapMinutes int
+	// MaxTempDirEarlyPlots is the max number of plots in phase 1 or 2 allowed per temp dir, 0 for no limit
+	MaxTempDirEarlyPlots int
+	// AllowSameFilesystem allows farm dirs on the same file system as a temp dir
+	AllowSameFilesystem bool
+	// MemoryHeadroomMB is the system memory that must stay available after a new plot's memory is accounted for
+	MemoryHeadroomMB int
+	// MaxSwapUsedMB is the max swap in use before new plots are refused, 0 for no limit
+	MaxSwapUsedMB int
+	// Plotter is the plotter backend to use: chia, madmax or bladebit
+	Plotter string
+	// PlotDirPlotters overrides the Plotter per plot dir
+	PlotDirPlotters map[string]string
+	// TempDir2 is the optional second temp dir passed to the plotter with -2
+	TempDir2     string
+	Buckets      int
+	MadmaxPath   string
+	BladebitPath string
+	// FarmerPublicKey is the farmer public key plots are created with, the plotter's default key if not set
+	FarmerPublicKey string
+	// PoolPublicKey is the pool public key solo plots are created with
+	PoolPublicKey string
+	// PoolContractAddress is the pool contract address pool plots are created with, it excludes PoolPublicKey
+	PoolContractAddress string
+	// Fingerprint selects the key of the chia keychain plots are created with, only supported by the chia plotter
+	Fingerprint int
+	// StateFile is the JSON file the state of running plots is persisted to
+	StateFile string
+	// HistoryFile is the JSON lines file the records of all finished plots are appended to
+	HistoryFile string
+	// VerifyPlots checks every finished plot with `chia plots check` and quarantines invalid plots
+	VerifyPlots bool
+	// VerifyChallenges is the number of challenges a plot is checked with
+	VerifyChallenges int
+	// VerifyMinProofPercent is the minimum percentage of the challenges with a proof for a plot to be valid, 50 if not set
+	VerifyMinProofPercent int
+	// QuarantineDir is the dir invalid plots are moved to, invalid plots are renamed to .bad in their dir if not set
+	QuarantineDir string
+	// StagingDir is the dir plots are written to before they are moved to the farm dirs in the background,
+	// empty to write plots to the farm dirs directly
+	StagingDir string
+	// MaxMovesPerDir is the max number of staged plots moved to a single farm dir at the same time
+	MaxMovesPerDir int
+	// MoveRetryMinutes is the number of minutes to wait before a failed move is retried
+	MoveRetryMinutes int
+	// MoveChecksum reads every moved plot back from the farm dir to compare its checksum with the staged plot
+	MoveChecksum bool
+	// PlotLogDir is the dir the output of each plot process is logged to
+	PlotLogDir string
+	// DrainTimeoutMinutes is the max number of minutes to wait for running plots on shutdown, 0 to wait forever
+	DrainTimeoutMinutes int
+	// StaleTempPolicy is what to do with plot temp files not owned by any running plot: ignore, report or delete
+	StaleTempPolicy string
+	// HTTPListen is the address the status and control API listens on, empty to disable it
+	HTTPListen string
+	// CPUPinning pins every plot to PerPlotThreads cores of its own
+	CPUPinning bool
+	// ReservedCores is the number of cores plots never run on, left to the chia daemons
+	ReservedCores int
+	// PinChiaDaemons pins the running chia daemons to the reserved cores
+	PinChiaDaemons bool
+	// Nice is the nice level plots are started with, 0 to leave it unchanged
+	Nice int
+	// IONiceClass is the io scheduling class plots are started with: realtime, best-effort or idle, empty to leave it unchanged
+	IONiceClass string
+	// IONiceLevel is the io priority within the realtime or best-effort class, 0 (highest) to 7
+	IONiceLevel int
+	// DirScanMinutes is the interval in minutes the dir patterns and mounts are scanned for new and removed dirs
+	DirScanMinutes int
+	// PlotDirStrategy is how the plot dir of a new plot is selected: round-robin, most-free, fill-first, weighted or lru
+	PlotDirStrategy string
+	// FarmDirStrategy is how the farm dir of a new plot is selected: round-robin, most-free, fill-first, weighted or lru
+	FarmDirStrategy string
+	// DirPriorities are the weights of the plot and farm dirs for the weighted strategy, dirs not listed have priority 1
+	DirPriorities map[string]int
+	// DirMaxConcurrent is the max number of running plots using a plot or farm dir, dirs not listed have no limit
+	DirMaxConcurrent map[string]int
+	// PlotDirConfigs are the [[plot_dir]] tables with the settings of single plot dirs, their dirs are added to PlotDirs
+	PlotDirConfigs []plotDirConfig `toml:"plot_dir"`
+	// FarmDirConfigs are the [[farm_dir]] tables with the settings of single farm dirs, their dirs are added to FarmDirs
+	FarmDirConfigs []farmDirConfig `toml:"farm_dir"`
+	// Replot configures which farmed plots are deleted to make room for new plots
+	Replot replotConfig
+	// MountScan configures which mounted file systems are used as farm dirs
+	MountScan mountScanConfig
+	// Notify configures the notification channels and routes
+	Notify notifyConfig
 }
 
 func (e *envVars) PerPlotMem() ByteSz {
@@ -34,7 +127,54 @@ func (e *envVars) MaxMemory() ByteSz {
 	return ByteSzFromMB(float64(e.MaxMemoryMB))
 }
 
-var env *envVars
+func (e *envVars) MemoryHeadroom() ByteSz {
+	return ByteSzFromMB(float64(e.MemoryHeadroomMB))
+}
+
+func (e *envVars) MaxSwapUsed() ByteSz {
+	return ByteSzFromMB(float64(e.MaxSwapUsedMB))
+}
+
+func (e *envVars) MinStartGap() time.Duration {
+	return time.Duration(e.MinStartGapMinutes) * time.Minute
+}
+
+func (e *envVars) DirScanInterval() time.Duration {
+	return time.Duration(e.DirScanMinutes) * time.Minute
+}
+
+func (e *envVars) DrainTimeout() time.Duration {
+	return time.Duration(e.DrainTimeoutMinutes) * time.Minute
+}
+
+func (e *envVars) MoveRetry() time.Duration {
+	return time.Duration(e.MoveRetryMinutes) * time.Minute
+}
+
+//Keys returns the keys plots are created with in the plot dirs without their own keys
+func (e *envVars) Keys() PlotKeys {
+	return PlotKeys{
+		FarmerPublicKey:     e.FarmerPublicKey,
+		PoolPublicKey:       e.PoolPublicKey,
+		PoolContractAddress: e.PoolContractAddress,
+		Fingerprint:         e.Fingerprint,
+	}
+}
+
+//currentEnv holds the *envVars in use, it is replaced as a whole when the config is reloaded
+var currentEnv atomic.Value
+
+//getEnv returns the env in use
+// callers reading several settings should get the env once so they see a consistent config
+func getEnv() *envVars {
+	e, _ := currentEnv.Load().(*envVars)
+	return e
+}
+
+//setEnv replaces the env in use
+func setEnv(e *envVars) {
+	currentEnv.Store(e)
+}
 
 var (
 	flagConfigFile,
@@ -46,118 +186,446 @@ var (
 	flagSMTPPass,
 	flagEmailTo,
 	flagEmailFrom,
+	flagPlotter,
+	flagStateFile,
+	flagHistoryFile,
+	flagPlotLogDir,
+	flagHTTPListen,
+	flagIONiceClass,
+	flagPlotDirStrategy,
+	flagFarmDirStrategy,
+	flagStagingDir,
+	flagFarmerKey,
+	flagPoolKey,
+	flagPoolContract,
 	flagChiaDir string
 
 	flagMaxMem,
+	flagMemHeadroom,
+	flagMaxSwapUsed,
 	flagPerPlotMem,
 	flagPerPlotThreads,
+	flagMaxPhase1Plots,
+	flagMinStartGap,
+	flagMaxTempDirEarlyPlots,
+	flagDrainTimeout,
+	flagReservedCores,
+	flagNice,
+	flagVerifyChallenges,
+	flagFingerprint,
 	flagSMTPPort int
-)
 
-func loadEnv() {
-
-	flag.Parse()
+	flagCPUPinning,
+	flagVerifyPlots bool
+)
 
-	env = new(envVars)
+//readEnv reads the config file and applies the flags and defaults on top of it
+// the result is validated but not put in use, so a reload can be rejected without affecting the running config
+// running is the env in use when the config is reloaded, nil otherwise
+func readEnv(running *envVars) (*envVars, error) {
+	e := new(envVars)
+	var errs configErrors
 
 	//if config file is passed, attempt to parse the toml file
 	if len(flagConfigFile) > 0 {
 		b, err := os.ReadFile(flagConfigFile)
 		if err != nil {
-			logFatalLn(err)
+			return nil, err
 		}
-		if err = toml.Unmarshal(b, env); err != nil {
-			logFatalLn(err)
+		md, err := toml.Decode(string(b), e)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range md.Undecoded() {
+			errs.add("unknown config key %s", key)
 		}
 	}
 
+	// the dirs of the tables are overridden by the dir flags like the flat lists
+	applyDirConfigs(e, &errs)
+
 	if flagMaxMem > 0 {
-		env.MaxMemoryMB = flagMaxMem
+		e.MaxMemoryMB = flagMaxMem
+	}
+
+	if flagMemHeadroom > 0 {
+		e.MemoryHeadroomMB = flagMemHeadroom
+	}
+
+	if flagMaxSwapUsed > 0 {
+		e.MaxSwapUsedMB = flagMaxSwapUsed
 	}
 
 	if flagPerPlotMem > 0 {
-		env.PerPlotMemMB = flagPerPlotMem
-	} else if env.PerPlotMemMB <= 0 {
+		e.PerPlotMemMB = flagPerPlotMem
+	} else if e.PerPlotMemMB <= 0 {
 		// default per plot mem MB
-		env.PerPlotMemMB = 3200
+		e.PerPlotMemMB = 3200
 	}
 
 	if flagPerPlotThreads > 0 {
-		env.PerPlotThreads = flagPerPlotThreads
-	} else if env.PerPlotThreads <= 0 {
+		e.PerPlotThreads = flagPerPlotThreads
+	} else if e.PerPlotThreads <= 0 {
 		// default per plot threads
-		env.PerPlotThreads = 2
+		e.PerPlotThreads = 2
+	}
+
+	if flagMaxPhase1Plots > 0 {
+		e.MaxPhase1Plots = flagMaxPhase1Plots
+	}
+
+	if flagMinStartGap > 0 {
+		e.MinStartGapMinutes = flagMinStartGap
+	}
+
+	if flagMaxTempDirEarlyPlots > 0 {
+		e.MaxTempDirEarlyPlots = flagMaxTempDirEarlyPlots
+	}
+
+	if len(flagPlotter) > 0 {
+		e.Plotter = flagPlotter
+	} else if len(e.Plotter) == 0 {
+		e.Plotter = PlotterChia
+	}
+
+	if _, err := newPlotter(e.Plotter); err != nil {
+		errs.add("%v", err)
+	}
+
+	for d, name := range e.PlotDirPlotters {
+		if _, err := newPlotter(name); err != nil {
+			errs.add("invalid plotter for plot dir %s: %v", d, err)
+		}
+	}
+
+	if len(e.MadmaxPath) == 0 {
+		e.MadmaxPath = "chia_plot"
+	}
+
+	if len(e.BladebitPath) == 0 {
+		e.BladebitPath = "bladebit"
+	}
+
+	if len(flagFarmerKey) > 0 {
+		e.FarmerPublicKey = flagFarmerKey
+	}
+
+	// the pool key and the pool contract exclude each other, so one passed as a flag replaces both of the config
+	if len(flagPoolKey) > 0 || len(flagPoolContract) > 0 {
+		e.PoolPublicKey = flagPoolKey
+		e.PoolContractAddress = flagPoolContract
+	}
+
+	if flagFingerprint > 0 {
+		e.Fingerprint = flagFingerprint
+	}
+
+	if len(flagStateFile) > 0 {
+		e.StateFile = flagStateFile
+	} else if len(e.StateFile) == 0 {
+		e.StateFile = "chiarunner-state.json"
+	}
+
+	if len(flagHistoryFile) > 0 {
+		e.HistoryFile = flagHistoryFile
+	} else if len(e.HistoryFile) == 0 {
+		e.HistoryFile = defaultHistoryFile
+	}
+
+	if flagVerifyPlots {
+		e.VerifyPlots = true
+	}
+
+	if flagVerifyChallenges > 0 {
+		e.VerifyChallenges = flagVerifyChallenges
+	} else if e.VerifyChallenges == 0 {
+		e.VerifyChallenges = defaultVerifyChallenges
+	}
+
+	if e.VerifyChallenges < 0 {
+		errs.add("invalid VerifyChallenges %d", e.VerifyChallenges)
+	}
+
+	if e.VerifyMinProofPercent == 0 {
+		e.VerifyMinProofPercent = 50
+	}
+
+	if e.VerifyMinProofPercent < 0 || e.VerifyMinProofPercent > 100 {
+		errs.add("invalid VerifyMinProofPercent %d, must be between 0 and 100", e.VerifyMinProofPercent)
+	}
+
+	if len(flagStagingDir) > 0 {
+		e.StagingDir = flagStagingDir
+	}
+
+	if e.MaxMovesPerDir <= 0 {
+		e.MaxMovesPerDir = 1
+	}
+
+	if e.MoveRetryMinutes <= 0 {
+		e.MoveRetryMinutes = 5
+	}
+
+	if len(flagPlotLogDir) > 0 {
+		e.PlotLogDir = flagPlotLogDir
+	} else if len(e.PlotLogDir) == 0 {
+		e.PlotLogDir = "chiarunner-logs"
+	}
+
+	if e.DirScanMinutes <= 0 {
+		e.DirScanMinutes = 5
+	}
+
+	if flagDrainTimeout > 0 {
+		e.DrainTimeoutMinutes = flagDrainTimeout
+	}
+
+	switch e.StaleTempPolicy {
+	case "":
+		e.StaleTempPolicy = StaleTempReport
+	case StaleTempIgnore, StaleTempReport, StaleTempDelete:
+	default:
+		errs.add("invalid StaleTempPolicy %q", e.StaleTempPolicy)
+	}
+
+	if len(flagHTTPListen) > 0 {
+		e.HTTPListen = flagHTTPListen
+	}
+
+	if flagCPUPinning {
+		e.CPUPinning = true
+	}
+
+	if flagReservedCores > 0 {
+		e.ReservedCores = flagReservedCores
+	}
+
+	if e.ReservedCores < 0 || e.ReservedCores >= runtime.NumCPU() {
+		errs.add("invalid ReservedCores %d, %d cores available", e.ReservedCores, runtime.NumCPU())
+	}
+
+	if e.PinChiaDaemons && e.ReservedCores == 0 {
+		errs.add("PinChiaDaemons requires ReservedCores")
+	}
+
+	if flagNice != 0 {
+		e.Nice = flagNice
+	}
+
+	if e.Nice < -20 || e.Nice > 19 {
+		errs.add("invalid Nice %d, must be between -20 and 19", e.Nice)
+	}
+
+	if len(flagIONiceClass) > 0 {
+		e.IONiceClass = flagIONiceClass
+	}
+
+	if _, ok := ioniceClasses[e.IONiceClass]; len(e.IONiceClass) > 0 && !ok {
+		errs.add("invalid IONiceClass %q", e.IONiceClass)
+	}
+
+	if e.IONiceLevel < 0 || e.IONiceLevel > 7 {
+		errs.add("invalid IONiceLevel %d, must be between 0 and 7", e.IONiceLevel)
+	}
+
+	if len(flagPlotDirStrategy) > 0 {
+		e.PlotDirStrategy = flagPlotDirStrategy
+	} else if len(e.PlotDirStrategy) == 0 {
+		e.PlotDirStrategy = SelectRoundRobin
+	}
+
+	if len(flagFarmDirStrategy) > 0 {
+		e.FarmDirStrategy = flagFarmDirStrategy
+	} else if len(e.FarmDirStrategy) == 0 {
+		e.FarmDirStrategy = SelectRoundRobin
+	}
+
+	if !selectStrategies[e.PlotDirStrategy] {
+		errs.add("invalid PlotDirStrategy %q", e.PlotDirStrategy)
+	}
+
+	if !selectStrategies[e.FarmDirStrategy] {
+		errs.add("invalid FarmDirStrategy %q", e.FarmDirStrategy)
+	}
+
+	for d, p := range e.DirPriorities {
+		if p < 1 {
+			errs.add("invalid priority %d for dir %s, must be at least 1", p, d)
+		}
+	}
+
+	for d, max := range e.DirMaxConcurrent {
+		if max < 0 {
+			errs.add("invalid max concurrent plots %d for dir %s", max, d)
+		}
+	}
+
+	e.Replot.check(&errs)
+
+	// the affinity and priorities are applied by running plots through these tools
+	var tools []string
+	if e.CPUPinning || e.ReservedCores > 0 {
+		tools = append(tools, "taskset")
+	}
+	if e.Nice != 0 {
+		tools = append(tools, "nice")
+	}
+	if len(e.IONiceClass) > 0 {
+		tools = append(tools, "ionice")
+	}
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			errs.add("%s is required for the configured cpu pinning and priorities: %v", tool, err)
+		}
 	}
 
 	if len(flagLogFile) > 0 {
-		env.LogFile = flagLogFile
+		e.LogFile = flagLogFile
 	}
 
 	if len(flagPlottingDirs) > 0 {
 		dirs := strings.Split(flagPlottingDirs, ",")
-		env.PlotDirs = make([]string, len(dirs))
+		e.PlotDirs = make([]string, len(dirs))
 		for i, d := range dirs {
-			env.PlotDirs[i] = strings.TrimSpace(d)
+			e.PlotDirs[i] = strings.TrimSpace(d)
 		}
 	}
 
 	if len(flagFarmingDirs) > 0 {
 		dirs := strings.Split(flagFarmingDirs, ",")
-		env.FarmDirs = make([]string, len(dirs))
+		e.FarmDirs = make([]string, len(dirs))
 		for i, d := range dirs {
-			env.FarmDirs[i] = strings.TrimSpace(d)
+			e.FarmDirs[i] = strings.TrimSpace(d)
 		}
 	}
 
 	if len(flagSMTPHost) > 0 {
-		env.SMTPHost = flagSMTPHost
+		e.SMTPHost = flagSMTPHost
 	}
 
 	if flagSMTPPort > 0 {
-		env.SMTPPort = flagSMTPPort
+		e.SMTPPort = flagSMTPPort
 	}
 
 	if len(flagSMTPUser) > 0 {
-		env.SMTPUser = flagSMTPUser
+		e.SMTPUser = flagSMTPUser
 	}
 
 	if len(flagSMTPPass) > 0 {
-		env.SMTPPassword = flagSMTPPass
+		e.SMTPPassword = flagSMTPPass
 	}
 
 	if len(flagEmailFrom) > 0 {
-		env.EmailFrom = flagEmailFrom
+		e.EmailFrom = flagEmailFrom
 	}
 
 	if len(flagEmailTo) > 0 {
 		addresses := strings.Split(flagEmailTo, ",")
-		env.EmailTo = make([]string, len(addresses))
+		e.EmailTo = make([]string, len(addresses))
 		for i, to := range addresses {
-			env.EmailTo[i] = to
+			e.EmailTo[i] = to
 		}
 	}
 
-	if env.MaxParallelPlots <= 0 {
-		cpuMax := runtime.NumCPU() / env.PerPlotThreads
-		memMax := env.MaxMemoryMB / env.PerPlotMemMB
-		env.MaxParallelPlots = int(math.Floor(math.Min(float64(cpuMax), float64(memMax))))
+	if len(flagChiaDir) > 0 {
+		e.ChiaDir = flagChiaDir
+	}
+
+	expandEnvPaths(e)
+
+	if len(e.ChiaDir) == 0 {
+		e.ChiaDir = detectChiaDir()
+	}
+
+	checkPlotKeys(e, &errs)
+	e.Replot.checkNewPlots(newPlotTypes(e), &errs)
+
+	for event, names := range e.Notify.Routes {
+		if !validRouteKey(event) {
+			errs.add("unknown event %q in the notification routes", event)
+			continue
+		}
+		for _, name := range names {
+			if _, err := newNotifier(name, e); err != nil {
+				errs.add("invalid notification route for %s: %v", event, err)
+			}
+		}
+	}
+
+	if plotter, err := newPlotter(e.Plotter); err == nil && e.MaxParallelPlots <= 0 {
+		cpuMax := (runtime.NumCPU() - e.ReservedCores) / e.PerPlotThreads
+		// the chia plotter uses the per plot memory of the env in use, which is not this one yet
+		mem := plotter.Memory
+		if plotter.Name() == PlotterChia {
+			mem = e.PerPlotMem
+		}
+		memMax := e.MaxMemory() / mem()
+		e.MaxParallelPlots = int(math.Floor(math.Min(float64(cpuMax), float64(memMax))))
+	}
+
+	errs = append(errs, checkEnv(e, running)...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return e, nil
+}
+
+//loadEnv loads the env, exiting with all problems found if the config is invalid
+func loadEnv() {
+	e, err := readEnv(nil)
+	if err != nil {
+		logFatalLn(err)
 	}
+	setEnv(e)
 }
 
 func init() {
 	// chia blockchain directory
-	flag.StringVar(&flagChiaDir, "chia-dir", "~/chia-blockchain", "chia blockchain directory")
+	flag.StringVar(&flagChiaDir, "chia-dir", "", "chia blockchain directory containing the activate script, "+
+		"detected in ~/chia-blockchain or chia is run from the PATH if not set")
 	flag.StringVar(&flagConfigFile, "config", "", "config TOML file to use")
 	// max memory flag
 	flag.IntVar(&flagMaxMem, "max-mem", 0, "max memory in MB")
+	flag.IntVar(&flagMemHeadroom, "mem-headroom", 0, "memory in MB that must stay available after starting a plot")
+	flag.IntVar(&flagMaxSwapUsed, "max-swap", 0, "max swap in use in MB before new plots are refused")
 	flag.IntVar(&flagPerPlotMem, "plot-mem", 0, "max memory to use per plot")
 	flag.IntVar(&flagPerPlotThreads, "plot-threads", 0, "cpu threads to use per plot")
+	// stagger flags
+	flag.IntVar(&flagMaxPhase1Plots, "max-phase1", 0, "max number of plots in phase 1 at the same time")
+	flag.IntVar(&flagMinStartGap, "start-gap", 0, "minimum minutes between plot starts")
+	flag.IntVar(&flagMaxTempDirEarlyPlots, "max-temp-dir-early", 0, "max number of plots in phase 1 or 2 per temp dir")
+	// plotter flag
+	flag.StringVar(&flagPlotter, "plotter", "", "plotter backend to use: chia, madmax or bladebit")
+	// key flags
+	flag.StringVar(&flagFarmerKey, "farmer-key", "", "farmer public key to create plots with")
+	flag.StringVar(&flagPoolKey, "pool-key", "", "pool public key to create solo plots with")
+	flag.StringVar(&flagPoolContract, "pool-contract", "", "pool contract address to create pool plots with")
+	flag.IntVar(&flagFingerprint, "fingerprint", 0, "fingerprint of the key to create plots with, chia plotter only")
+	// cpu and priority flags
+	flag.BoolVar(&flagCPUPinning, "pin-cpus", false, "pin every plot to cores of its own")
+	flag.IntVar(&flagReservedCores, "reserved-cores", 0, "number of cores plots never run on")
+	flag.IntVar(&flagNice, "nice", 0, "nice level plots are started with")
+	flag.StringVar(&flagIONiceClass, "ionice", "", "io scheduling class plots are started with: realtime, best-effort or idle")
+	flag.StringVar(&flagPlotDirStrategy, "plot-strategy", "", "how plot dirs are selected: round-robin, most-free, fill-first, weighted or lru")
+	flag.StringVar(&flagFarmDirStrategy, "farm-strategy", "", "how farm dirs are selected: round-robin, most-free, fill-first, weighted or lru")
+	// drain flag
+	flag.IntVar(&flagDrainTimeout, "drain-timeout", 0, "minutes to wait for running plots on shutdown before killing them")
 	// log file flag
 	flag.StringVar(&flagLogFile, "log", "", "log output file")
+	// state flags
+	flag.StringVar(&flagStateFile, "state-file", "", "file to persist the state of running plots to")
+	flag.StringVar(&flagHistoryFile, "history-file", "", "file to append the records of finished plots to")
+	flag.StringVar(&flagPlotLogDir, "plot-log-dir", "", "dir to write the output of each plot process to")
+	// verification flags
+	flag.BoolVar(&flagVerifyPlots, "verify", false, "check every finished plot with chia plots check")
+	flag.IntVar(&flagVerifyChallenges, "verify-challenges", 0, "number of challenges to check finished plots with")
+	// http api flag
+	flag.StringVar(&flagHTTPListen, "http", "", "address to serve the status and control API on, e.g. 127.0.0.1:8555")
 	// plotting dirs flag
 	flag.StringVar(&flagPlottingDirs, "temp-dirs", "", "comma delimited list of temporary plotting dirs")
 	// farming dirs flag
 	flag.StringVar(&flagFarmingDirs, "farm-dirs", "", "comma delimited list of farming dirs")
+	flag.StringVar(&flagStagingDir, "staging-dir", "", "dir to write plots to before they are moved to the farm dirs")
 	// smtp flags
 	flag.StringVar(&flagSMTPHost, "smtp-host", "", "SMTP server host")
 	flag.IntVar(&flagSMTPPort, "smtp-port", 0, "SMTP server port")
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+)
+
+//Health is the health state of a plot or farm dir
+type Health string
+
+const (
+	HealthHealthy  Health = "healthy"
+	HealthDegraded Health = "degraded"
+	HealthOffline  Health = "offline"
+	HealthFull     Health = "full"
+	HealthReadOnly Health = "read-only"
+
+	// ioErrorPeriod is how long a dir stays degraded after a plot process reported an I/O error in it
+	ioErrorPeriod = 30 * time.Minute
+	// probeInterval is how often a write probe is done in a healthy dir, unhealthy dirs are probed on every check
+	probeInterval = 10 * time.Minute
+)
+
+// reIOError matches the plotter output lines reporting a failing drive
+var reIOError = regexp.MustCompile(`(?i)input/output error|read-only file system|no space left on device`)
+
+//Health returns the health of the dir and the reason it is not healthy
+func (d *dir) Health() (Health, string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.health, d.healthReason
+}
+
+//Healthy returns true if the dir is healthy and can be used for new plots
+func (d *dir) Healthy() bool {
+	h, _ := d.Health()
+	return h == HealthHealthy
+}
+
+//healthString formats a health state along with the reason the dir is not healthy
+func healthString(h Health, reason string) string {
+	if len(reason) == 0 {
+		return string(h)
+	}
+	return fmt.Sprintf("%s (%s)", h, reason)
+}
+
+//setHealth sets the health of the dir, changes are logged and notified
+func (d *dir) setHealth(h Health, reason string) {
+	d.mu.Lock()
+	prev := d.health
+	d.health = h
+	d.healthReason = reason
+	d.mu.Unlock()
+	if prev == h {
+		return
+	}
+	if h == HealthHealthy {
+		logF("directory %s is healthy again, it was %s\n", d.dirStr, prev)
+		Notify(EventDirHealth, 0, fmt.Sprintf("directory %s recovered", d.dirStr),
+			fmt.Sprintf("directory %s was %s and is healthy again, new plots use it", d.dirStr, prev))
+		return
+	}
+	logErrF("directory %s is %s: %s\n", d.dirStr, h, reason)
+	Notify(EventDirHealth, 0, fmt.Sprintf("directory %s is %s", d.dirStr, h),
+		fmt.Sprintf("directory %s was %s and is now %s:\n%s\n\n"+
+			"no new plots use it until it recovers", d.dirStr, prev, h, reason))
+}
+
+//ReportIOError marks the dir degraded after a plot process reported an I/O error in it
+func (d *dir) ReportIOError(msg string) {
+	d.mu.Lock()
+	d.ioErr = msg
+	d.ioErrAt = time.Now()
+	d.mu.Unlock()
+	d.setHealth(HealthDegraded, "plot I/O error: "+msg)
+}
+
+//checkHealth updates the health of the dir from its file system stats, a write probe and the I/O errors
+// reported by plot processes
+// need is the space a new plot needs in the dir, freeable is the space that can be freed for it on top of the
+// available space
+func (d *dir) checkHealth(need, freeable ByteSz) {
+	stat, err := d.stat(d.dirStr)
+	if err != nil {
+		d.setHealth(HealthOffline, err.Error())
+		return
+	}
+
+	d.mu.RLock()
+	probe := d.health != HealthHealthy || time.Since(d.probedAt) >= probeInterval
+	ioErr, ioErrAt := d.ioErr, d.ioErrAt
+	running := len(d.activePIDs)
+	d.mu.RUnlock()
+
+	if probe {
+		err = checkDir(d.dirStr)
+		d.mu.Lock()
+		d.probedAt = time.Now()
+		d.mu.Unlock()
+		switch {
+		case err == nil:
+		case errors.Is(err, syscall.EROFS), errors.Is(err, syscall.EACCES), errors.Is(err, syscall.EPERM):
+			d.setHealth(HealthReadOnly, err.Error())
+			return
+		case errors.Is(err, syscall.ENOSPC):
+			d.setHealth(HealthFull, err.Error())
+			return
+		default:
+			d.setHealth(HealthDegraded, err.Error())
+			return
+		}
+	}
+
+	if !ioErrAt.IsZero() && time.Since(ioErrAt) < ioErrorPeriod {
+		d.setHealth(HealthDegraded, "plot I/O error: "+ioErr)
+		return
+	}
+	// the space of running plots is still being written, so only a dir without plots is full
+	if running == 0 && stat.Available.Add(freeable) < need {
+		d.setHealth(HealthFull, fmt.Sprintf("%s available, a plot needs %s", stat.Available.Add(freeable), need))
+		return
+	}
+	d.setHealth(HealthHealthy, "")
+}
+
+//CheckHealth updates the health of the plot dir
+func (p *PlotDir) CheckHealth() {
+	p.checkHealth(p.Plotter().TempSpace(), 0)
+}
+
+//CheckHealth updates the health of the farm dir
+// the replaceable plots are deleted when a new plot needs their space, so a dir full of them is not full
+func (f *FarmDir) CheckHealth() {
+	f.checkHealth(FarmPlotSpace, f.Replaceable())
+}
+
+//reportIOError reports an I/O error in a line of plotter output to the dir it happened in
+// errors that do not name a dir are reported to the plot dir, which gets most of the I/O
+func reportIOError(line string, plotDir *PlotDir, farmDir *FarmDir) {
+	if !reIOError.MatchString(line) {
+		return
+	}
+	line = strings.TrimSpace(line)
+	switch {
+	case plotDir != nil && strings.Contains(line, plotDir.dirStr):
+		plotDir.ReportIOError(line)
+	case farmDir != nil && strings.Contains(line, farmDir.dirStr):
+		farmDir.ReportIOError(line)
+	case plotDir != nil:
+		plotDir.ReportIOError(line)
+	}
+}
+
+//plotOutput returns the handler of the plotter output lines of the plot with the given PID
+// it tracks the plot progress, passes the plot ID on to the dirs of the plot once it is known and reports I/O errors
+// to them, onCopy is called once the plot starts copying its final plot file to the farm dir
+func plotOutput(pid int, progress *PlotProgress, plotDir *PlotDir, farmDir *FarmDir, onCopy func()) func(line string) {
+	var (
+		plotID  string
+		copying bool
+	)
+	return func(line string) {
+		progress.ParseLine(line)
+		if !copying && onCopy != nil && progress.Snapshot().Phase >= PhaseCopy {
+			copying = true
+			onCopy()
+		}
+		if len(plotID) == 0 {
+			if plotID = progress.Snapshot().PlotID; len(plotID) > 0 {
+				if plotDir != nil {
+					plotDir.SetPlotID(pid, plotID)
+				}
+				if farmDir != nil {
+					farmDir.SetPlotID(pid, plotID)
+				}
+			}
+		}
+		reportIOError(line, plotDir, farmDir)
+	}
+}
+
+//checkDirHealth updates the health of all plot and farm dirs and the staging dir
+func (r *Runner) checkDirHealth() {
+	for _, pd := range r.PlotPool.Dirs() {
+		pd.CheckHealth()
+	}
+	for _, fd := range r.FarmPool.Dirs() {
+		fd.CheckHealth()
+	}
+	if r.staging != nil {
+		r.staging.CheckHealth()
+	}
+}
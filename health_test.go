@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestDirHealth(t *testing.T) {
+	tmp := t.TempDir()
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{})
+
+	plotter, err := newPlotter(PlotterBladebit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := filepath.Join(tmp, "plots")
+	if err = os.Mkdir(d, 0755); err != nil {
+		t.Fatal(err)
+	}
+	pd := newPlotDir(d, plotter)
+	pool := &PlotPool{mu: &sync.RWMutex{}}
+	pool.AddDirs(pd)
+
+	expect := func(want Health) {
+		t.Helper()
+		if h, reason := pd.Health(); h != want {
+			t.Fatalf("expected %s, got %s (%s)", want, h, reason)
+		}
+	}
+
+	pd.checkHealth(0, 0)
+	expect(HealthHealthy)
+
+	// a dir without room for a plot is full, unless plots are still writing to it
+	pd.checkHealth(ByteSz(1<<62), 0)
+	expect(HealthFull)
+	pd.AddPID(1)
+	pd.checkHealth(ByteSz(1<<62), 0)
+	expect(HealthHealthy)
+	pd.RmPID(1)
+
+	reportIOError("write failed: Input/output error", pd, nil)
+	expect(HealthDegraded)
+	pd.checkHealth(0, 0)
+	expect(HealthDegraded)
+	if _, err = pool.NextUp(nil); err != ErrMaxProcessesReached {
+		t.Errorf("expected the degraded dir to be skipped, got %v", err)
+	}
+	pd.ioErrAt = pd.ioErrAt.Add(-ioErrorPeriod)
+	pd.checkHealth(0, 0)
+	expect(HealthHealthy)
+
+	// the dir stats of a vanished drive don't fail anymore, the dir goes offline until it is back
+	if err = os.Remove(d); err != nil {
+		t.Fatal(err)
+	}
+	if stat := pd.DiskStat(); stat.Total != 0 {
+		t.Errorf("expected an empty disk stat, got %+v", stat)
+	}
+	expect(HealthOffline)
+	pd.checkHealth(0, 0)
+	expect(HealthOffline)
+	if err = os.Mkdir(d, 0755); err != nil {
+		t.Fatal(err)
+	}
+	pd.checkHealth(0, 0)
+	expect(HealthHealthy)
+
+	reportIOError("plotting finished", pd, nil)
+	expect(HealthHealthy)
+	// a farm dir full of replaceable plots is not full, they are deleted when a new plot needs their space
+	fd := NewFarmDir(d)
+	fd.stat = fakeStats{d: FarmPlotSpace / 2}.stat
+	fd.CheckHealth()
+	if h, _ := fd.Health(); h != HealthFull {
+		t.Errorf("expected the farm dir without room for a plot to be full, got %s", h)
+	}
+	fd.setReplaceable(FarmPlotSpace)
+	fd.CheckHealth()
+	if h, reason := fd.Health(); h != HealthHealthy {
+		t.Errorf("expected the farm dir with replaceable plots to be healthy, got %s (%s)", h, reason)
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const defaultHistoryFile = "chiarunner-history.jsonl"
+
+//newHistoryStore creates a new historyStore appending to the given file, an empty path disables the store
+func newHistoryStore(path string) *historyStore {
+	return &historyStore{
+		path: path,
+		mu:   &sync.Mutex{},
+	}
+}
+
+//historyStore appends the PlotResult of every finished plot to a JSON lines file
+type historyStore struct {
+	path string
+	mu   *sync.Mutex
+}
+
+//Append appends the result to the history file
+func (h *historyStore) Append(res PlotResult) error {
+	if len(h.path) == 0 {
+		return nil
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+//Load reads all records of the history file, oldest first
+// lines that can not be parsed, like a line cut short by a crash, are skipped and counted
+func (h *historyStore) Load() ([]PlotResult, int, error) {
+	if len(h.path) == 0 {
+		return nil, 0, nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	f, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	return parseHistory(f)
+}
+
+//Update applies update to the records of the given plot file and rewrites the history file
+// the lines that can not be parsed are kept as they are
+func (h *historyStore) Update(plotFile string, update func(res *PlotResult)) error {
+	if len(h.path) == 0 {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	b, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var (
+		buf     bytes.Buffer
+		updated bool
+	)
+	for _, line := range strings.SplitAfter(string(b), "\n") {
+		var res PlotResult
+		if json.Unmarshal([]byte(line), &res) != nil || res.PlotFile != plotFile {
+			buf.WriteString(line)
+			continue
+		}
+		update(&res)
+		rb, err := json.Marshal(res)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(rb, '\n'))
+		updated = true
+	}
+	if !updated {
+		return nil
+	}
+	// the file is replaced as a whole, so a crash leaves either the old or the new history
+	tmp := h.path + ".tmp"
+	if err = os.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+//parseHistory parses the records of a history file
+func parseHistory(r io.Reader) ([]PlotResult, int, error) {
+	var (
+		records []PlotResult
+		bad     int
+	)
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if len(line) == 0 {
+			continue
+		}
+		var res PlotResult
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			bad++
+			continue
+		}
+		records = append(records, res)
+	}
+	return records, bad, sc.Err()
+}
+
+//finalPlotFile returns the path and size of the plot file with the given plot ID in the farm dir
+func finalPlotFile(plotID, farmDir string) (string, ByteSz) {
+	if len(plotID) == 0 || len(farmDir) == 0 {
+		return "", 0
+	}
+	matches, _ := filepath.Glob(filepath.Join(farmDir, "*"+plotID+"*.plot"))
+	for _, m := range matches {
+		if fi, err := os.Stat(m); err == nil {
+			return m, ByteSz(fi.Size())
+		}
+	}
+	return "", 0
+}
+
+//historyFilter selects the history records to list
+type historyFilter struct {
+	Since   time.Time
+	Plotter string
+	TempDir string
+	FarmDir string
+	Status  string
+	// Pool is the pool contract address or the pool public key of the plots
+	Pool string
+	Last int
+}
+
+//matchDir returns true if the dir matches the filter, which may be a glob pattern
+func matchDir(filter, dir string) bool {
+	if len(filter) == 0 || filter == dir {
+		return true
+	}
+	ok, _ := filepath.Match(filter, dir)
+	return ok
+}
+
+//Apply returns the records matching the filter
+func (f historyFilter) Apply(records []PlotResult) []PlotResult {
+	var out []PlotResult
+	for _, res := range records {
+		switch {
+		case res.StartTime.Before(f.Since):
+		case len(f.Plotter) > 0 && res.Plotter != f.Plotter:
+		case !matchDir(f.TempDir, res.TempDir), !matchDir(f.FarmDir, res.FarmDir):
+		case len(f.Pool) > 0 && res.Pool() != f.Pool:
+		case f.Status == "ok" && len(res.Error) > 0:
+		case f.Status == "failed" && len(res.Error) == 0:
+		default:
+			out = append(out, res)
+		}
+	}
+	if f.Last > 0 && len(out) > f.Last {
+		out = out[len(out)-f.Last:]
+	}
+	return out
+}
+
+//parseSince parses a duration that may also be given in days, like 7d
+func parseSince(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(s)
+}
+
+//roundDuration rounds a duration to seconds for printing, a zero duration is printed as -
+func roundDuration(d time.Duration) string {
+	if d <= 0 {
+		return "-"
+	}
+	return d.Round(time.Second).String()
+}
+
+//printHistory prints one line per record
+func printHistory(w io.Writer, records []PlotResult) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "START\tSTATUS\tPLOTTER\tTHREADS\tTEMP DIR\tFARM DIR\tTOTAL\tCOPY\tPOOL\tPLOT")
+	for _, res := range records {
+		status := "ok"
+		if res.Verification != nil && !res.Verification.Valid {
+			status = "invalid"
+		} else if len(res.Error) > 0 {
+			status = fmt.Sprintf("failed (%d)", res.ExitCode)
+		}
+		plotFile := "-"
+		if len(res.PlotFile) > 0 {
+			plotFile = fmt.Sprintf("%s (%s)", filepath.Base(res.PlotFile), res.PlotSize)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			res.StartTime.Format("2006-01-02 15:04"), status, res.Plotter, res.Threads, res.TempDir, res.FarmDir,
+			roundDuration(res.TotalTime), roundDuration(res.CopyTime), res.Pool(), plotFile)
+	}
+	tw.Flush()
+}
+
+//phaseStats sums the phase times of the finished plots of a temp dir
+type phaseStats struct {
+	n      int
+	phases [4]time.Duration
+	total  time.Duration
+	copy   time.Duration
+}
+
+//printAggregates prints the plots per day and the mean phase times per temp dir of the records
+func printAggregates(w io.Writer, records []PlotResult) {
+	if len(records) == 0 {
+		fmt.Fprintln(w, "no plots")
+		return
+	}
+	var (
+		ok, failed int
+		first      = records[0].StartTime
+		last       = records[0].EndTime
+		perDay     = map[string]int{}
+		perDir     = map[string]*phaseStats{}
+	)
+	for _, res := range records {
+		if res.StartTime.Before(first) {
+			first = res.StartTime
+		}
+		if res.EndTime.After(last) {
+			last = res.EndTime
+		}
+		if len(res.Error) > 0 {
+			failed++
+			continue
+		}
+		ok++
+		perDay[res.EndTime.Local().Format("2006-01-02")]++
+		st, found := perDir[res.TempDir]
+		if !found {
+			st = &phaseStats{}
+			perDir[res.TempDir] = st
+		}
+		st.n++
+		for i, d := range res.PhaseTimes {
+			st.phases[i] += d
+		}
+		st.total += res.TotalTime
+		st.copy += res.CopyTime
+	}
+
+	days := last.Sub(first).Hours() / 24
+	if days < 1 {
+		days = 1
+	}
+	fmt.Fprintf(w, "\n%d plots, %d ok, %d failed, %.2f plots/day from %s to %s\n\n",
+		len(records), ok, failed, float64(ok)/days, first.Format("2006-01-02 15:04"), last.Format("2006-01-02 15:04"))
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "DAY\tPLOTS")
+	dayKeys := make([]string, 0, len(perDay))
+	for day := range perDay {
+		dayKeys = append(dayKeys, day)
+	}
+	sort.Strings(dayKeys)
+	for _, day := range dayKeys {
+		fmt.Fprintf(tw, "%s\t%d\n", day, perDay[day])
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TEMP DIR\tPLOTS\tPHASE 1\tPHASE 2\tPHASE 3\tPHASE 4\tTOTAL\tCOPY")
+	dirKeys := make([]string, 0, len(perDir))
+	for d := range perDir {
+		dirKeys = append(dirKeys, d)
+	}
+	sort.Strings(dirKeys)
+	for _, d := range dirKeys {
+		st := perDir[d]
+		n := time.Duration(st.n)
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\n", d, st.n,
+			roundDuration(st.phases[0]/n), roundDuration(st.phases[1]/n), roundDuration(st.phases[2]/n),
+			roundDuration(st.phases[3]/n), roundDuration(st.total/n), roundDuration(st.copy/n))
+	}
+	tw.Flush()
+}
+
+//historyPath returns the history file of the -history-file flag or the config file without validating the rest
+// of the config, so the history can be read on any machine
+func historyPath() (string, error) {
+	path := flagHistoryFile
+	if len(path) == 0 && len(flagConfigFile) > 0 {
+		var c struct{ HistoryFile string }
+		if _, err := toml.DecodeFile(flagConfigFile, &c); err != nil {
+			return "", err
+		}
+		path = c.HistoryFile
+	}
+	if len(path) == 0 {
+		path = defaultHistoryFile
+	}
+	return expandPath(path), nil
+}
+
+//history runs the history command listing the finished plots matching the filter flags in args
+// it returns the exit code of the command
+func history(args []string) int {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	since := fs.String("since", "", "only plots started within this duration, like 12h or 7d")
+	plotter := fs.String("plotter", "", "only plots of this plotter")
+	tempDir := fs.String("temp-dir", "", "only plots using this temp dir, glob patterns are allowed")
+	farmDir := fs.String("farm-dir", "", "only plots using this farm dir, glob patterns are allowed")
+	status := fs.String("status", "", "only ok or failed plots")
+	pool := fs.String("pool", "", "only plots of this pool contract address or pool public key")
+	last := fs.Int("last", 0, "only the last n plots")
+	asJSON := fs.Bool("json", false, "print the records as JSON lines without aggregates")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := historyFilter{Plotter: *plotter, TempDir: expandPath(*tempDir), FarmDir: expandPath(*farmDir),
+		Status: *status, Pool: *pool, Last: *last}
+	if len(*since) > 0 {
+		d, err := parseSince(*since)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		filter.Since = time.Now().Add(-d)
+	}
+	if filter.Status != "" && filter.Status != "ok" && filter.Status != "failed" {
+		fmt.Fprintf(os.Stderr, "invalid status %q, must be ok or failed\n", filter.Status)
+		return 2
+	}
+
+	path, err := historyPath()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	records, bad, err := newHistoryStore(path).Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if bad > 0 {
+		fmt.Fprintf(os.Stderr, "skipped %d invalid records in %s\n", bad, path)
+	}
+	records = filter.Apply(records)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		for _, res := range records {
+			if err = enc.Encode(res); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return 1
+			}
+		}
+		return 0
+	}
+	printHistory(os.Stdout, records)
+	printAggregates(os.Stdout, records)
+	return 0
+}
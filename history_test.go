@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHistoryStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	store := newHistoryStore(path)
+
+	start := time.Date(2021, 6, 1, 8, 0, 0, 0, time.Local)
+	records := []PlotResult{
+		{PID: 1, Plotter: PlotterChia, TempDir: "/mnt/nvme", FarmDir: "/mnt/farm1", Threads: 4,
+			StartTime: start, EndTime: start.Add(10 * time.Hour),
+			PhaseTimes: [4]time.Duration{4 * time.Hour, 2 * time.Hour, 3 * time.Hour, time.Hour},
+			TotalTime:  10 * time.Hour, CopyTime: 10 * time.Minute, PlotFile: "/mnt/farm1/plot-k32-a.plot"},
+		{PID: 2, Plotter: PlotterChia, TempDir: "/mnt/sata", FarmDir: "/mnt/farm2",
+			StartTime: start.Add(time.Hour), EndTime: start.Add(2 * time.Hour),
+			ExitCode: 1, Error: "exit status 1"},
+		{PID: 3, Plotter: PlotterMadmax, TempDir: "/mnt/nvme", FarmDir: "/mnt/farm2", Threads: 8,
+			StartTime: start.Add(24 * time.Hour), EndTime: start.Add(30 * time.Hour),
+			PhaseTimes: [4]time.Duration{2 * time.Hour, time.Hour, 2 * time.Hour, time.Hour},
+			TotalTime:  6 * time.Hour, CopyTime: 20 * time.Minute,
+			PlotKeys: PlotKeys{FarmerPublicKey: testFarmerKey, PoolContractAddress: testContract}},
+	}
+	for _, res := range records {
+		if err := store.Append(res); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a record cut short by a crash is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"PID":4,"Plot`)
+	f.Close()
+
+	loaded, bad, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad != 1 || len(loaded) != len(records) {
+		t.Fatalf("expected %d records and 1 invalid record, got %d and %d", len(records), len(loaded), bad)
+	}
+	for i := range records {
+		if fmt.Sprintf("%+v", loaded[i]) != fmt.Sprintf("%+v", records[i]) {
+			t.Errorf("record %d changed:\n%+v\n%+v", i, records[i], loaded[i])
+		}
+	}
+
+	// a staged plot is moved to its farm dir
+	moved := "/mnt/farm2/plot-k32-a.plot"
+	err = store.Update(records[0].PlotFile, func(res *PlotResult) {
+		res.PlotFile, res.FarmDir = moved, filepath.Dir(moved)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded, bad, err = store.Load(); err != nil || bad != 1 || len(loaded) != len(records) {
+		t.Fatalf("expected the records to be kept, got %d records, %d invalid, %v", len(loaded), bad, err)
+	}
+	if loaded[0].PlotFile != moved || loaded[0].FarmDir != "/mnt/farm2" || loaded[0].PID != 1 {
+		t.Errorf("expected the plot file to be updated, got %+v", loaded[0])
+	}
+	if fmt.Sprintf("%+v", loaded[1:]) != fmt.Sprintf("%+v", records[1:]) {
+		t.Errorf("expected the other records unchanged, got %+v", loaded[1:])
+	}
+	// the filters below expect the records as they were appended
+	loaded[0] = records[0]
+
+	filters := []struct {
+		filter historyFilter
+		pids   []int
+	}{
+		{historyFilter{}, []int{1, 2, 3}},
+		{historyFilter{Since: start.Add(12 * time.Hour)}, []int{3}},
+		{historyFilter{Plotter: PlotterChia}, []int{1, 2}},
+		{historyFilter{TempDir: "/mnt/nvme"}, []int{1, 3}},
+		{historyFilter{FarmDir: "/mnt/farm*", Status: "failed"}, []int{2}},
+		{historyFilter{Status: "ok", Last: 1}, []int{3}},
+		{historyFilter{Pool: testContract}, []int{3}},
+	}
+	for _, tt := range filters {
+		var pids []int
+		for _, res := range tt.filter.Apply(loaded) {
+			pids = append(pids, res.PID)
+		}
+		if fmt.Sprint(pids) != fmt.Sprint(tt.pids) {
+			t.Errorf("%+v: expected plots %v, got %v", tt.filter, tt.pids, pids)
+		}
+	}
+
+	var buf bytes.Buffer
+	printAggregates(&buf, loaded)
+	for _, exp := range []string{
+		"3 plots, 2 ok, 1 failed, 1.60 plots/day",
+		"2021-06-01  1",
+		"/mnt/nvme  2      3h0m0s   1h30m0s  2h30m0s  1h0m0s   8h0m0s  15m0s",
+	} {
+		if !strings.Contains(buf.String(), exp) {
+			t.Errorf("expected %q in the aggregates:\n%s", exp, buf.String())
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	for s, exp := range map[string]time.Duration{
+		"12h":  12 * time.Hour,
+		"7d":   7 * 24 * time.Hour,
+		"1.5d": 36 * time.Hour,
+	} {
+		d, err := parseSince(s)
+		if err != nil || d != exp {
+			t.Errorf("%s: expected %s, got %s %v", s, exp, d, err)
+		}
+	}
+	if _, err := parseSince("xd"); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
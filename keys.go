@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	bech32mConst  = 0x2bc830a3
+
+	// a pool contract address holds a 32 byte puzzle hash, 52 characters of 5 bits, and a 6 character checksum
+	contractDataLen = 52 + 6
+	// public keys are 48 byte BLS G1 elements
+	publicKeySize = 48
+)
+
+var contractPrefixes = []string{"xch", "txch"}
+
+//PlotKeys are the keys a plot is created with, the plotter uses its defaults for the keys that are not set
+// a plot is either a solo plot with a pool public key or a pool plot with a pool contract address
+type PlotKeys struct {
+	FarmerPublicKey     string `json:",omitempty"`
+	PoolPublicKey       string `json:",omitempty"`
+	PoolContractAddress string `json:",omitempty"`
+	Fingerprint         int    `json:",omitempty"`
+}
+
+//Pool returns the pool contract address of a pool plot or the pool public key of a solo plot, - if neither is set
+func (k PlotKeys) Pool() string {
+	switch {
+	case len(k.PoolContractAddress) > 0:
+		return k.PoolContractAddress
+	case len(k.PoolPublicKey) > 0:
+		return k.PoolPublicKey
+	}
+	return "-"
+}
+
+//Type returns the type of the plots created with the keys, plots without a pool contract address are solo plots
+func (k PlotKeys) Type() string {
+	if len(k.PoolContractAddress) > 0 {
+		return PlotTypePool
+	}
+	return PlotTypeSolo
+}
+
+//args returns the plotter arguments passing the keys that are set
+// the fingerprint is only passed if the plotter supports selecting a key by fingerprint
+func (k PlotKeys) args(fingerprint bool) []string {
+	var args []string
+	if len(k.FarmerPublicKey) > 0 {
+		args = append(args, "-f", k.FarmerPublicKey)
+	}
+	if len(k.PoolPublicKey) > 0 {
+		args = append(args, "-p", k.PoolPublicKey)
+	}
+	if len(k.PoolContractAddress) > 0 {
+		args = append(args, "-c", k.PoolContractAddress)
+	}
+	if fingerprint && k.Fingerprint > 0 {
+		args = append(args, "-a", strconv.Itoa(k.Fingerprint))
+	}
+	return args
+}
+
+//check adds the problems with the format of the keys to errs, where tells where the keys are configured
+func (k PlotKeys) check(where string, errs *configErrors) {
+	if len(k.FarmerPublicKey) > 0 {
+		if err := checkPublicKey(k.FarmerPublicKey); err != nil {
+			errs.add("invalid farmer public key for %s: %v", where, err)
+		}
+	}
+	if len(k.PoolPublicKey) > 0 {
+		if err := checkPublicKey(k.PoolPublicKey); err != nil {
+			errs.add("invalid pool public key for %s: %v", where, err)
+		}
+	}
+	if len(k.PoolContractAddress) > 0 {
+		if err := checkContractAddress(k.PoolContractAddress); err != nil {
+			errs.add("invalid pool contract address for %s: %v", where, err)
+		}
+	}
+	if len(k.PoolPublicKey) > 0 && len(k.PoolContractAddress) > 0 {
+		errs.add("both a pool public key and a pool contract address are set for %s", where)
+	}
+	if k.Fingerprint < 0 || int64(k.Fingerprint) > 1<<32-1 {
+		errs.add("invalid fingerprint %d for %s", k.Fingerprint, where)
+	}
+}
+
+//checkPublicKey returns an error if the key is not a hex encoded public key
+func checkPublicKey(key string) error {
+	b, err := hex.DecodeString(strings.TrimPrefix(key, "0x"))
+	if err != nil {
+		return fmt.Errorf("not hex encoded: %v", err)
+	}
+	if len(b) != publicKeySize {
+		return fmt.Errorf("%d bytes, a public key has %d", len(b), publicKeySize)
+	}
+	return nil
+}
+
+//checkContractAddress returns an error if the address is not a bech32m encoded pool contract address
+func checkContractAddress(addr string) error {
+	sep := strings.LastIndexByte(addr, '1')
+	if sep < 1 {
+		return fmt.Errorf("no address prefix")
+	}
+	prefix, data := addr[:sep], addr[sep+1:]
+	found := false
+	for _, p := range contractPrefixes {
+		found = found || p == prefix
+	}
+	if !found {
+		return fmt.Errorf("unknown prefix %q, must be one of %s", prefix, strings.Join(contractPrefixes, ", "))
+	}
+	if len(data) != contractDataLen {
+		return fmt.Errorf("%d characters after the prefix, an address has %d", len(data), contractDataLen)
+	}
+	values := make([]int, len(data))
+	for i, c := range data {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return fmt.Errorf("invalid character %q", c)
+		}
+		values[i] = v
+	}
+	if bech32Polymod(append(bech32HRPExpand(prefix), values...)) != bech32mConst {
+		return fmt.Errorf("invalid checksum")
+	}
+	return nil
+}
+
+//bech32HRPExpand expands the human readable part of a bech32 string for the checksum
+func bech32HRPExpand(hrp string) []int {
+	out := make([]int, 0, len(hrp)*2+1)
+	for _, c := range hrp {
+		out = append(out, int(c)>>5)
+	}
+	out = append(out, 0)
+	for _, c := range hrp {
+		out = append(out, int(c)&31)
+	}
+	return out
+}
+
+//bech32Polymod computes the bech32 checksum of the values
+func bech32Polymod(values []int) int {
+	gen := []int{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+	chk := 1
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ v
+		for i, g := range gen {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= g
+			}
+		}
+	}
+	return chk
+}
+
+//checkPlotKeys adds the problems with the global keys and the keys of the plot dirs to errs
+// the fingerprint is only passed to the chia plotter, it is an error for the dirs of the other plotters
+func checkPlotKeys(e *envVars, errs *configErrors) {
+	e.Keys().check("the global config", errs)
+	for _, c := range e.PlotDirConfigs {
+		c.Keys().check("plot_dir "+c.Path, errs)
+	}
+	for _, d := range keyedPlotDirs(e) {
+		s := e.PlotDirSettings(d)
+		if s.Fingerprint == 0 {
+			continue
+		}
+		if p, err := newPlotter(s.Plotter); err == nil && p.Name() != PlotterChia {
+			errs.add("a fingerprint is set for plot dir %s, which the %s plotter does not support, set the keys instead", d, p.Name())
+		}
+	}
+}
+
+//keyedPlotDirs returns the plot dirs of the config along with the dirs of the [[plot_dir]] tables
+func keyedPlotDirs(e *envVars) []string {
+	dirs := append([]string(nil), e.PlotDirs...)
+	for _, c := range e.PlotDirConfigs {
+		dirs = appendDir(dirs, c.Path)
+	}
+	return dirs
+}
+
+//newPlotTypes returns the types of the plots the plot dirs create with their keys
+func newPlotTypes(e *envVars) []string {
+	dirs := keyedPlotDirs(e)
+	if len(dirs) == 0 {
+		return []string{e.Keys().Type()}
+	}
+	var types []string
+	seen := map[string]bool{}
+	for _, d := range dirs {
+		if t := e.PlotDirSettings(d).Keys().Type(); !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+	return types
+}
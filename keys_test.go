@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const (
+	testFarmerKey    = "8f1ad3a2b40c2a2f5b4b6c7e3f2d1a09b8c7d6e5f4a3b2c1d0e9f8a7b6c5d4e3a1b0c9d8e7f6a5b4c3d2e1f0a9b8c7d6"
+	testPoolKey      = "0xb3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2"
+	testContract     = "xch1qqqsyqcyq5rqwzqfpg9scrgwpugpzysnzs23v9ccrydpk8qarc0srg6dkm"
+	testTestContract = "txch1v3jkvemgd94xkmrddehhqutjwd682anh0puh57mu04l8lqyps2psgvc9aw"
+)
+
+func TestPlotKeysCheck(t *testing.T) {
+	tests := []struct {
+		keys   PlotKeys
+		expect string
+	}{
+		{PlotKeys{}, ""},
+		{PlotKeys{FarmerPublicKey: testFarmerKey, PoolContractAddress: testContract, Fingerprint: 1234567890}, ""},
+		{PlotKeys{FarmerPublicKey: testFarmerKey, PoolPublicKey: testPoolKey}, ""},
+		{PlotKeys{PoolContractAddress: testTestContract}, ""},
+		{PlotKeys{FarmerPublicKey: testFarmerKey[:94]}, "47 bytes"},
+		{PlotKeys{PoolPublicKey: "zz" + testFarmerKey[2:]}, "not hex encoded"},
+		{PlotKeys{PoolPublicKey: testPoolKey, PoolContractAddress: testContract}, "both a pool public key"},
+		{PlotKeys{PoolContractAddress: "bch" + testContract[3:]}, "unknown prefix"},
+		{PlotKeys{PoolContractAddress: testContract[:len(testContract)-1]}, "57 characters"},
+		{PlotKeys{PoolContractAddress: strings.ToUpper(testContract)}, "unknown prefix"},
+		{PlotKeys{PoolContractAddress: testContract[:10] + "b" + testContract[11:]}, "invalid character"},
+		{PlotKeys{PoolContractAddress: testContract[:10] + "p" + testContract[11:]}, "invalid checksum"},
+		{PlotKeys{Fingerprint: -1}, "invalid fingerprint"},
+		{PlotKeys{Fingerprint: 1 << 32}, "invalid fingerprint"},
+	}
+	for _, tt := range tests {
+		var errs configErrors
+		tt.keys.check("test", &errs)
+		switch {
+		case len(tt.expect) == 0 && len(errs) > 0:
+			t.Errorf("%+v: unexpected problems %v", tt.keys, errs)
+		case len(tt.expect) > 0 && (len(errs) != 1 || !strings.Contains(errs[0], tt.expect)):
+			t.Errorf("%+v: expected a problem containing %q, got %v", tt.keys, tt.expect, errs)
+		}
+	}
+}
+
+func TestPlotterKeyArgs(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{MadmaxPath: "chia_plot", BladebitPath: "bladebit"})
+
+	job := PlotJob{TempDir: "/tmp/a", FarmDir: "/mnt/farm", Threads: 4, MemMB: 3400,
+		Keys: PlotKeys{FarmerPublicKey: testFarmerKey, PoolContractAddress: testContract, Fingerprint: 42}}
+	keyArgs := "-f " + testFarmerKey + " -c " + testContract
+	tests := []struct {
+		plotter Plotter
+		expect  string
+	}{
+		{chiaPlotter{}, keyArgs + " -a 42"},
+		{madmaxPlotter{}, keyArgs},
+		// bladebit takes the farm dir last
+		{bladebitPlotter{}, keyArgs + " /mnt/farm"},
+	}
+	for _, tt := range tests {
+		cmdline := strings.Join(tt.plotter.Cmd(job).Args, " ")
+		if !strings.Contains(cmdline, tt.expect) {
+			t.Errorf("%s: expected %q in %q", tt.plotter.Name(), tt.expect, cmdline)
+		}
+		if tt.plotter.Name() != PlotterChia && strings.Contains(cmdline, " -a ") {
+			t.Errorf("%s: expected no fingerprint in %q", tt.plotter.Name(), cmdline)
+		}
+	}
+
+	cmdline := strings.Join(madmaxPlotter{}.Cmd(PlotJob{TempDir: "/tmp/a", FarmDir: "/mnt/farm"}).Args, " ")
+	for _, arg := range []string{" -f ", " -p ", " -c "} {
+		if strings.Contains(cmdline, arg) {
+			t.Errorf("expected no %s without keys in %q", arg, cmdline)
+		}
+	}
+}
+
+func TestPlotDirKeys(t *testing.T) {
+	tmp := t.TempDir()
+	prevConfigFile := flagConfigFile
+	defer func() { flagConfigFile = prevConfigFile }()
+	flagConfigFile = filepath.Join(tmp, "config.toml")
+
+	dir := func(d string) string {
+		return filepath.Join(tmp, d)
+	}
+	config := testConfig(t, tmp, "nvme", "sata", "farm") + fmt.Sprintf(`MaxParallelPlots = 2
+FarmDirs = [%q]
+FarmerPublicKey = %q
+PoolContractAddress = %q
+Fingerprint = 42
+
+[[plot_dir]]
+path = %q
+plotter = "chia"
+
+[[plot_dir]]
+path = %q
+pool_public_key = %q
+`, dir("farm"), testFarmerKey, testContract, dir("nvme"), dir("sata"), testPoolKey)
+	if err := os.WriteFile(flagConfigFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// the fingerprint can not be passed to bladebit, the global plotter of the sata dir
+	_, err := readEnv(nil)
+	if err == nil || !strings.Contains(err.Error(), "fingerprint is set for plot dir "+dir("sata")) {
+		t.Errorf("expected the fingerprint to be rejected for the bladebit dir, got %v", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "plot dir "+dir("nvme")) {
+		t.Errorf("expected the fingerprint to be accepted for the chia dir, got %v", err)
+	}
+
+	// the chia plotter needs more temp space than the test dirs have
+	config = strings.Replace(config, "Fingerprint = 42\n", "", 1)
+	config = strings.Replace(config, "plotter = \"chia\"\n", "", 1)
+	if err = os.WriteFile(flagConfigFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := readEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the pool key of the table replaces the global pool contract, the farmer key is the global one
+	tests := []struct {
+		dir    string
+		expect PlotKeys
+	}{
+		{dir("nvme"), PlotKeys{FarmerPublicKey: testFarmerKey, PoolContractAddress: testContract}},
+		{dir("sata"), PlotKeys{FarmerPublicKey: testFarmerKey, PoolPublicKey: testPoolKey}},
+	}
+	for _, tt := range tests {
+		if got := e.PlotDirSettings(tt.dir).Keys(); got != tt.expect {
+			t.Errorf("%s: expected %+v, got %+v", tt.dir, tt.expect, got)
+		}
+	}
+}
+
+func TestNewPlotTypes(t *testing.T) {
+	tests := []struct {
+		env    envVars
+		expect []string
+	}{
+		{envVars{}, []string{PlotTypeSolo}},
+		{envVars{PoolContractAddress: testContract}, []string{PlotTypePool}},
+		{envVars{PlotDirs: []string{"/plot/a"}, PoolContractAddress: testContract}, []string{PlotTypePool}},
+		// a plot dir table with a pool public key creates solo plots next to the global pool plots
+		{envVars{PlotDirs: []string{"/plot/a"}, PoolContractAddress: testContract,
+			PlotDirConfigs: []plotDirConfig{{Path: "/plot/b", PoolPublicKey: testPoolKey}}}, []string{PlotTypePool, PlotTypeSolo}},
+	}
+	for _, tt := range tests {
+		if got := newPlotTypes(&tt.env); fmt.Sprint(got) != fmt.Sprint(tt.expect) {
+			t.Errorf("%+v: expected %v, got %v", tt.env.PlotDirs, tt.expect, got)
+		}
+	}
+}
@@ -52,13 +52,13 @@ func logErrLn(v ...interface{}) {
 }
 
 func logFatalF(fm string, v ...interface{}) {
-	SendEmail("chiarunner fatal error", fmt.Sprintf("[FATAL] + " + fm, v...))
+	NotifySync(EventFatal, 0, "chiarunner fatal error", fmt.Sprintf("[FATAL] " + fm, v...))
 	log.Fatalf("[FATAL] " + fm, v...)
 }
 
 func logFatalLn(v ...interface{}) {
-	// send email on fatal error
-	SendEmail("chiarunner fatal error", fmt.Sprintf("[FATAL] %+v", v))
+	// send a notification on fatal error
+	NotifySync(EventFatal, 0, "chiarunner fatal error", fmt.Sprintf("[FATAL] %+v", v))
 	log.Fatalln(append([]interface{}{"[FATAL]"}, v...)...)
 }
 
@@ -6,6 +6,7 @@ import (
 )
 
 func sendEmail(subject, body string) error {
+	env := getEnv()
 	m := mail.NewMessage()
 
 	// Set E-Mail sender
@@ -32,12 +33,3 @@ func sendEmail(subject, body string) error {
 	}
 	return nil
 }
-
-func SendEmail(subject, body string) {
-	go func() {
-		if err := sendEmail(subject, body); err != nil {
-			logErrLn("Failed sending email:", err)
-
-		}
-	}()
-}
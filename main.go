@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
 	"runtime"
@@ -11,42 +13,112 @@ import (
 
 
 func main() {
+	flag.Parse()
+	switch cmd := flag.Arg(0); cmd {
+	case "":
+	case "validate":
+		os.Exit(validate())
+	case "history":
+		os.Exit(history(flag.Args()[1:]))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n", cmd)
+		os.Exit(2)
+	}
+
 	loadEnv()
+	env := getEnv()
+	initLogger(&env.LogFile)
+	logF("using chia %s\n", chiaInstall(env))
 	mem := getMemStats()
 	logF("Starting chiarunner...\n"+
 		"System CPU threads: %d\n"+
 		"System Free mem: %s\n"+
+		"System Available mem: %s\n"+
 		"System Total mem: %s\n",
 		runtime.NumCPU(),
 		mem.Free.String(),
+		mem.Available.String(),
 		mem.Total.String())
 
 	r := newRunner()
 	logF("Max parallel plots: %d\n", env.MaxParallelPlots)
 
-	for _, d := range env.FarmDirs {
-		fd := NewFarmDir(d)
-		r.FarmPool.AddDirs(fd)
-		logF("added farm directory %s", d)
-	}
+	r.syncDirs(env)
 
-	for _, d := range env.PlotDirs {
-		pd := newPlotDir(d)
-		r.PlotPool.AddDirs(pd)
-		logF("added plot directory %s\n", d)
-	}
+	// re-attach to plots that were started by a previous run
+	r.adoptPlots()
+
+	// find temp files left behind by plots that failed or were killed
+	r.sweepStaleTempFiles()
 
 	// log the current status
 	logLn(r.StatusString())
 
+	if len(env.HTTPListen) > 0 {
+		srv := newAPIServer(env.HTTPListen, r)
+		go func() {
+			logF("serving status and control API on %s\n", env.HTTPListen)
+			if err := srv.ListenAndServe(); err != nil {
+				logErrLn("API server stopped:", err)
+			}
+		}()
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
 	go func() {
+		// the first signal drains, a second signal or the drain timeout kills all running plots
 		sig := <-sigs
-		logErrLn("signal", sig, "called", ". Terminating...")
+		logErrLn("signal", sig, "called", ". Draining, send again to kill all plots...")
+		r.Drain()
+		var timeout <-chan time.Time
+		if d := getEnv().DrainTimeout(); d > 0 {
+			timeout = time.After(d)
+		}
+		select {
+		case sig = <-sigs:
+			logErrLn("signal", sig, "called again", ". Terminating...")
+		case <-timeout:
+			logErrLn("drain timeout of", getEnv().DrainTimeout(), "reached", ". Terminating...")
+		}
 		cancel()
 	}()
+
+	// SIGUSR1 pauses scheduling to empty the box without shutting down, SIGUSR2 resumes it
+	ctrl := make(chan os.Signal, 1)
+	signal.Notify(ctrl, syscall.SIGUSR1, syscall.SIGUSR2)
+	go func() {
+		for sig := range ctrl {
+			if sig == syscall.SIGUSR1 {
+				r.Pause()
+			} else {
+				r.Resume()
+			}
+		}
+	}()
+
+	// SIGHUP and changes to the config file reload the config without touching running plots
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			logLn("SIGHUP received, reloading config...")
+			if err := r.Reload(); err != nil {
+				logErrLn(err)
+			}
+		}
+	}()
+	if len(flagConfigFile) > 0 {
+		go r.watchConfig(ctx, flagConfigFile, 10*time.Second)
+	}
+
+	// pick up drives matching the dir patterns or mount rules as they come and go
+	go r.scanDirs(ctx, env.DirScanInterval())
+
+	// move staged plots to the farm dirs in the background
+	go r.mover.run(ctx, moveScanInterval)
+
 	r.runner(ctx, time.Minute)
 	runtime.SetFinalizer(r, func(r *Runner) {
 		cancel()
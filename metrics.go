@@ -0,0 +1,326 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//phaseDurationBuckets are the histogram buckets in seconds for plot phase durations
+var phaseDurationBuckets = []float64{300, 600, 1200, 1800, 3600, 2 * 3600, 3 * 3600, 4 * 3600, 6 * 3600, 8 * 3600, 12 * 3600}
+
+//metrics holds the counters and histograms exported on the /metrics endpoint
+var metrics = struct {
+	PlotsStarted   *counterVec
+	PlotsCompleted *counterVec
+	PlotsFailed    *counterVec
+	PhaseDuration  *histogramVec
+	EmailFailures  *counterVec
+	NotifyFailures *counterVec
+	PlotsMoved     *counterVec
+	MoveFailures   *counterVec
+	PlotsReplaced  *counterVec
+}{
+	PlotsStarted: newCounterVec("chiarunner_plots_started_total",
+		"Number of plot processes started.", "plotter", "temp_dir"),
+	PlotsCompleted: newCounterVec("chiarunner_plots_completed_total",
+		"Number of plot processes that finished successfully.", "plotter", "temp_dir"),
+	PlotsFailed: newCounterVec("chiarunner_plots_failed_total",
+		"Number of plot processes that failed or were killed.", "plotter", "temp_dir"),
+	PhaseDuration: newHistogramVec("chiarunner_plot_phase_duration_seconds",
+		"Duration of the plot phases of finished plots.", phaseDurationBuckets, "plotter", "temp_dir", "phase"),
+	EmailFailures: newCounterVec("chiarunner_email_send_failures_total",
+		"Number of emails that could not be sent."),
+	NotifyFailures: newCounterVec("chiarunner_notify_failures_total",
+		"Number of notifications that could not be sent.", "channel"),
+	PlotsMoved: newCounterVec("chiarunner_plots_moved_total",
+		"Number of staged plots moved to a farm dir.", "farm_dir"),
+	MoveFailures: newCounterVec("chiarunner_plot_move_failures_total",
+		"Number of failed attempts to move a staged plot to a farm dir.", "farm_dir"),
+	PlotsReplaced: newCounterVec("chiarunner_plots_replaced_total",
+		"Number of old plots deleted to make room for new plots.", "farm_dir"),
+}
+
+//labelKey joins label values into a map key
+func labelKey(values []string) string {
+	return strings.Join(values, "\x00")
+}
+
+//labelString formats label names and values in the Prometheus text format
+func labelString(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, n, escapeLabel(values[i]))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+//escapeLabel escapes a label value for the Prometheus text format
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+//formatFloat formats a sample value for the Prometheus text format
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+//newCounterVec creates a new counterVec with the given label names
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	return &counterVec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: map[string]float64{},
+		mu:     &sync.Mutex{},
+	}
+}
+
+//counterVec is a Prometheus counter partitioned by label values
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values map[string]float64
+	mu     *sync.Mutex
+}
+
+//Inc increments the counter with the given label values
+func (c *counterVec) Inc(values ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[labelKey(values)]++
+}
+
+//Write writes the counter in the Prometheus text format
+func (c *counterVec) Write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 {
+		fmt.Fprintf(w, "%s %s\n", c.name, formatFloat(c.values[""]))
+		return
+	}
+	for _, k := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelString(c.labels, strings.Split(k, "\x00")), formatFloat(c.values[k]))
+	}
+}
+
+//newHistogramVec creates a new histogramVec with the given buckets and label names
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{
+		name:    name,
+		help:    help,
+		buckets: buckets,
+		labels:  labels,
+		counts:  map[string][]uint64{},
+		sums:    map[string]float64{},
+		totals:  map[string]uint64{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+//histogramVec is a Prometheus histogram partitioned by label values
+type histogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	labels  []string
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+	mu      *sync.Mutex
+}
+
+//Observe adds an observation to the histogram with the given label values
+func (h *histogramVec) Observe(v float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k := labelKey(values)
+	counts, ok := h.counts[k]
+	if !ok {
+		counts = make([]uint64, len(h.buckets))
+		h.counts[k] = counts
+	}
+	for i, b := range h.buckets {
+		if v <= b {
+			counts[i]++
+		}
+	}
+	h.sums[k] += v
+	h.totals[k]++
+}
+
+//Write writes the histogram in the Prometheus text format
+func (h *histogramVec) Write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	names := append(append([]string{}, h.labels...), "le")
+	for _, k := range sortedKeys(h.sums) {
+		values := strings.Split(k, "\x00")
+		for i, b := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(names, append(values, formatFloat(b))), h.counts[k][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelString(names, append(values, "+Inf")), h.totals[k])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelString(h.labels, values), formatFloat(h.sums[k]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelString(h.labels, values), h.totals[k])
+	}
+}
+
+//sortedKeys returns the keys of the given map sorted
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//gauge writes the header of a gauge in the Prometheus text format
+func gauge(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+}
+
+//observePlot records the outcome and phase durations of a finished plot
+func observePlot(res PlotResult) {
+	if len(res.Error) > 0 {
+		metrics.PlotsFailed.Inc(res.Plotter, res.TempDir)
+		return
+	}
+	metrics.PlotsCompleted.Inc(res.Plotter, res.TempDir)
+	for i, d := range res.PhaseTimes {
+		if d > 0 {
+			metrics.PhaseDuration.Observe(d.Seconds(), res.Plotter, res.TempDir, strconv.Itoa(i+1))
+		}
+	}
+}
+
+//writeMetrics writes all metrics of the given Runner in the Prometheus text format
+func writeMetrics(w io.Writer, r *Runner) {
+	st := r.Status()
+
+	gauge(w, "chiarunner_plots_active", "Number of active plots per phase.")
+	active := map[string]float64{}
+	for _, p := range st.Plots {
+		active[labelKey([]string{p.Plotter, p.PhaseString()})]++
+	}
+	for _, k := range sortedKeys(active) {
+		fmt.Fprintf(w, "chiarunner_plots_active%s %s\n",
+			labelString([]string{"plotter", "phase"}, strings.Split(k, "\x00")), formatFloat(active[k]))
+	}
+
+	gauge(w, "chiarunner_scheduling_paused", "1 if scheduling new plots is paused.")
+	paused := 0
+	if st.Paused {
+		paused = 1
+	}
+	fmt.Fprintf(w, "chiarunner_scheduling_paused %d\n", paused)
+
+	dirGauges := []struct {
+		name, help string
+		value      func(DirStatus) int64
+	}{
+		{"chiarunner_dir_total_bytes", "Total size of the dir file system.", func(d DirStatus) int64 { return d.Total.B() }},
+		{"chiarunner_dir_used_bytes", "Used space of the dir file system.", func(d DirStatus) int64 { return d.Used.B() }},
+		{"chiarunner_dir_available_bytes", "Available space of the dir file system.", func(d DirStatus) int64 { return d.Available.B() }},
+		{"chiarunner_dir_reserved_bytes", "Space reserved for active plots.", func(d DirStatus) int64 { return d.Reserved.B() }},
+		{"chiarunner_dir_plots_available", "Number of plots that fit in the available space.", func(d DirStatus) int64 { return int64(d.PlotsAvailable) }},
+		{"chiarunner_dir_healthy", "1 if the dir is healthy and gets new plots.", func(d DirStatus) int64 {
+			if d.Health == HealthHealthy {
+				return 1
+			}
+			return 0
+		}},
+	}
+	dirLabels := []string{"dir", "role", "plotter"}
+	for _, g := range dirGauges {
+		gauge(w, g.name, g.help)
+		for _, d := range st.PlotDirs {
+			fmt.Fprintf(w, "%s%s %d\n", g.name, labelString(dirLabels, []string{d.Path, "plot", d.Plotter}), g.value(d))
+		}
+		for _, d := range st.FarmDirs {
+			fmt.Fprintf(w, "%s%s %d\n", g.name, labelString(dirLabels, []string{d.Path, "farm", ""}), g.value(d))
+		}
+	}
+
+	if mem, err := memStats(); err == nil {
+		gauge(w, "chiarunner_memory_bytes", "System memory statistics.")
+		for _, m := range []struct {
+			kind string
+			size ByteSz
+		}{
+			{"total", mem.Total}, {"used", mem.Used}, {"cached", mem.Cached}, {"free", mem.Free},
+			{"swap_total", mem.SwapTotal}, {"swap_used", mem.SwapUsed}, {"swap_free", mem.SwapFree},
+		} {
+			fmt.Fprintf(w, "chiarunner_memory_bytes{kind=\"%s\"} %d\n", m.kind, m.size.B())
+		}
+	}
+
+	if farm := st.Chia.Farm; farm != nil {
+		gauge(w, "chiarunner_farming", "1 if the farmer is farming.")
+		farming := 0
+		if farm.Farming {
+			farming = 1
+		}
+		fmt.Fprintf(w, "chiarunner_farming{status=\"%s\"} %d\n", escapeLabel(farm.FarmingStatus), farming)
+		gauge(w, "chiarunner_farm_plots", "Number of plots farmed by all harvesters.")
+		fmt.Fprintf(w, "chiarunner_farm_plots %d\n", farm.PlotCount)
+		gauge(w, "chiarunner_farm_size_bytes", "Total size of the farmed plots.")
+		fmt.Fprintf(w, "chiarunner_farm_size_bytes %d\n", farm.TotalSize.B())
+		gauge(w, "chiarunner_farm_chia_farmed", "Total chia farmed.")
+		fmt.Fprintf(w, "chiarunner_farm_chia_farmed %s\n", formatFloat(farm.TotalFarmed))
+		gauge(w, "chiarunner_network_space_bytes", "Estimated network space.")
+		fmt.Fprintf(w, "chiarunner_network_space_bytes %s\n", formatFloat(farm.NetworkSpace))
+		gauge(w, "chiarunner_expected_time_to_win_seconds", "Expected time to win, 0 if unknown.")
+		fmt.Fprintf(w, "chiarunner_expected_time_to_win_seconds %s\n", formatFloat(farm.TimeToWin.Seconds()))
+	}
+
+	if wallet := st.Chia.Wallet; wallet != nil {
+		gauge(w, "chiarunner_wallet_synced", "1 if the wallet is synced.")
+		synced := 0
+		if wallet.Synced {
+			synced = 1
+		}
+		fmt.Fprintf(w, "chiarunner_wallet_synced %d\n", synced)
+		gauge(w, "chiarunner_wallet_height", "Wallet height.")
+		fmt.Fprintf(w, "chiarunner_wallet_height %d\n", wallet.Height)
+		gauge(w, "chiarunner_wallet_balance_mojo", "Wallet balances in mojo.")
+		walletLabels := []string{"wallet_id", "type", "balance"}
+		for _, b := range wallet.Wallets {
+			id := strconv.Itoa(b.ID)
+			fmt.Fprintf(w, "chiarunner_wallet_balance_mojo%s %d\n", labelString(walletLabels, []string{id, b.Type, "total"}), b.TotalMojo)
+			fmt.Fprintf(w, "chiarunner_wallet_balance_mojo%s %d\n", labelString(walletLabels, []string{id, b.Type, "pending_total"}), b.PendingTotalMojo)
+			fmt.Fprintf(w, "chiarunner_wallet_balance_mojo%s %d\n", labelString(walletLabels, []string{id, b.Type, "spendable"}), b.SpendableMojo)
+		}
+	}
+
+	metrics.PlotsStarted.Write(w)
+	metrics.PlotsCompleted.Write(w)
+	metrics.PlotsFailed.Write(w)
+	metrics.PhaseDuration.Write(w)
+	metrics.EmailFailures.Write(w)
+	metrics.NotifyFailures.Write(w)
+	metrics.PlotsMoved.Write(w)
+	metrics.MoveFailures.Write(w)
+	metrics.PlotsReplaced.Write(w)
+}
+
+//metricsHandler serves the metrics of the given Runner for Prometheus to scrape
+func metricsHandler(r *Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		writeMetrics(&buf, r)
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = w.Write(buf.Bytes())
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMetricsFormat(t *testing.T) {
+	c := newCounterVec("test_total", "Test counter.", "plotter", "temp_dir")
+	c.Inc("chia", "/tmp/a")
+	c.Inc("chia", "/tmp/a")
+	c.Inc("madmax", `/tmp/"b"`)
+
+	h := newHistogramVec("test_seconds", "Test histogram.", []float64{10, 100}, "phase")
+	h.Observe(5, "1")
+	h.Observe(50, "1")
+	h.Observe(500, "1")
+
+	var buf bytes.Buffer
+	c.Write(&buf)
+	h.Write(&buf)
+
+	expected := `# HELP test_total Test counter.
+# TYPE test_total counter
+test_total{plotter="chia",temp_dir="/tmp/a"} 2
+test_total{plotter="madmax",temp_dir="/tmp/\"b\""} 1
+# HELP test_seconds Test histogram.
+# TYPE test_seconds histogram
+test_seconds_bucket{phase="1",le="10"} 1
+test_seconds_bucket{phase="1",le="100"} 2
+test_seconds_bucket{phase="1",le="+Inf"} 3
+test_seconds_sum{phase="1"} 555
+test_seconds_count{phase="1"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{MaxParallelPlots: 2, StateFile: t.TempDir() + "/state.json"})
+
+	metrics.PlotsMoved.Inc("/metrics/farm")
+	metrics.MoveFailures.Inc("/metrics/farm")
+	metrics.PlotsReplaced.Inc("/metrics/farm")
+
+	var buf bytes.Buffer
+	writeMetrics(&buf, newRunner())
+	for _, name := range []string{"chiarunner_plots_active", "chiarunner_dir_available_bytes", "chiarunner_email_send_failures_total 0",
+		`chiarunner_plots_moved_total{farm_dir="/metrics/farm"}`, `chiarunner_plot_move_failures_total{farm_dir="/metrics/farm"}`,
+		`chiarunner_plots_replaced_total{farm_dir="/metrics/farm"}`} {
+		if !strings.Contains(buf.String(), name) {
+			t.Errorf("expected metrics to contain %q", name)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	moveBufferSize   = 8 << 20
+	moveLogInterval  = 10 * time.Minute
+	moveScanInterval = 30 * time.Second
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// ErrStagingFull is returned when the staging dir has no space for another plot until staged plots are moved
+	ErrStagingFull = fmt.Errorf("no space in the staging dir")
+
+	errPlotExists = fmt.Errorf("plot already exists in the farm dir")
+)
+
+//MoveStatus is the status of a staged plot that is moved or waits to be moved to a farm dir
+type MoveStatus struct {
+	PlotFile string
+	FarmDir  string `json:",omitempty"`
+	Size     ByteSz
+	Copied   ByteSz
+	Started  time.Time `json:",omitempty"`
+	Attempts int
+	Error    string    `json:",omitempty"`
+	RetryAt  time.Time `json:",omitempty"`
+}
+
+//String returns the progress of the move
+func (m MoveStatus) String() string {
+	switch {
+	case len(m.FarmDir) > 0:
+		pct := 0.0
+		if m.Size > 0 {
+			pct = float64(m.Copied) / float64(m.Size) * 100
+		}
+		return fmt.Sprintf("%s -> %s: %s of %s (%.1f%%) in %s", filepath.Base(m.PlotFile), m.FarmDir,
+			m.Copied, m.Size, pct, time.Since(m.Started).Truncate(time.Second))
+	case len(m.Error) > 0:
+		return fmt.Sprintf("%s: attempt %d failed: %s, retrying at %s", filepath.Base(m.PlotFile), m.Attempts,
+			m.Error, m.RetryAt.Format("15:04"))
+	default:
+		return fmt.Sprintf("%s: waiting for a farm dir", filepath.Base(m.PlotFile))
+	}
+}
+
+//plotMove is a staged plot file that is moved to a farm dir
+type plotMove struct {
+	// copied is first so it is aligned for the atomic operations on 32 bit platforms
+	copied   int64
+	src      string
+	size     ByteSz
+	farmDir  *FarmDir
+	started  time.Time
+	attempts int
+	err      string
+	retryAt  time.Time
+}
+
+//newMover creates a new mover moving the plots in the staging dir to the farm dirs of the pool
+// a nil staging dir disables the mover, the tracker has the progress of the plots writing to the staging dir
+func newMover(staging *FarmDir, pool *FarmPool, replot *replotter, tracker *PlotTracker) *mover {
+	return &mover{
+		staging: staging,
+		pool:    pool,
+		replot:  replot,
+		tracker: tracker,
+		moves:   map[string]*plotMove{},
+		wake:    make(chan struct{}, 1),
+		mu:      &sync.Mutex{},
+	}
+}
+
+//mover moves finished plots from the staging dir to the farm dirs in the background
+// every farm dir gets at most MaxMovesPerDir moves at the same time, failed moves are retried
+type mover struct {
+	staging *FarmDir
+	pool    *FarmPool
+	replot  *replotter
+	tracker *PlotTracker
+	// onMoved is called with the staged plot file and the plot file in the farm dir once a plot is moved
+	onMoved func(src, dst string)
+	moves   map[string]*plotMove
+	wake    chan struct{}
+	mu      *sync.Mutex
+}
+
+//Wake makes the mover look for staged plots right away
+func (m *mover) Wake() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+//run moves the staged plots until the context is done
+func (m *mover) run(ctx context.Context, interval time.Duration) {
+	if m.staging == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		m.schedule()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-m.wake:
+		}
+	}
+}
+
+//stagedPlots returns the finished plot files in the staging dir
+// the files of plots that are still running, or being verified, are left alone
+// the file of a plot with an unknown ID can not be told apart from the others, but it was written after the plot
+// started, so only the files written since the start of the first such plot are left alone until its ID is known
+// false is returned if the staging dir can not be read
+func (m *mover) stagedPlots() ([]string, bool) {
+	files, err := filepath.Glob(filepath.Join(m.staging.dirStr, "*.plot"))
+	if err != nil {
+		return nil, false
+	}
+	m.staging.mu.RLock()
+	ids := make([]string, 0, len(m.staging.activePIDs))
+	var unknown []int
+	for pid, id := range m.staging.activePIDs {
+		if len(id) == 0 {
+			unknown = append(unknown, pid)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	m.staging.mu.RUnlock()
+	var (
+		hold  bool
+		since time.Time
+	)
+	for _, pid := range unknown {
+		// a plot without progress record holds back all files
+		var start time.Time
+		if p, ok := m.tracker.Get(pid); ok {
+			start = p.Snapshot().StartTime
+		}
+		if !hold || start.Before(since) {
+			hold, since = true, start
+		}
+	}
+	var staged []string
+fileLoop:
+	for _, f := range files {
+		for _, id := range ids {
+			if strings.Contains(filepath.Base(f), id) {
+				continue fileLoop
+			}
+		}
+		if hold {
+			if fi, err := os.Stat(f); err != nil || !fi.ModTime().Before(since) {
+				continue
+			}
+		}
+		staged = append(staged, f)
+	}
+	sort.Strings(staged)
+	return staged, true
+}
+
+//schedule picks up new staged plots and starts the moves that have a farm dir available
+func (m *mover) schedule() {
+	env := getEnv()
+	staged, ok := m.stagedPlots()
+	if !ok {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found := make(map[string]bool, len(staged))
+	for _, f := range staged {
+		found[f] = true
+		if _, ok := m.moves[f]; ok {
+			continue
+		}
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		m.moves[f] = &plotMove{src: f, size: ByteSz(fi.Size())}
+		logF("staged plot %s (%s) is waiting to be moved\n", f, ByteSz(fi.Size()))
+	}
+	for f, mv := range m.moves {
+		if !found[f] && mv.farmDir == nil {
+			// removed by hand or moved by a previous run
+			delete(m.moves, f)
+		}
+	}
+
+	for _, f := range staged {
+		mv := m.moves[f]
+		if mv.farmDir != nil || time.Now().Before(mv.retryAt) {
+			continue
+		}
+		fd, err := m.pool.NextUp(func(fd *FarmDir) bool {
+			return fd.Moves() < env.MaxMovesPerDir
+		})
+		if err != nil {
+			// the other staged plots don't fit either
+			return
+		}
+		need := mv.size.Add(fd.writing("")).Add(fd.movesReserved())
+		if err = m.replot.MakeRoom(fd, need, m.pool.Dirs()); err != nil {
+			logErrF("could not make room for %s: %v\n", mv.src, err)
+			continue
+		}
+		mv.farmDir = fd
+		mv.started = time.Now()
+		atomic.StoreInt64(&mv.copied, 0)
+		fd.addMove(moveTmpFile(mv.src, fd.dirStr), mv.size)
+		go m.move(mv, fd)
+	}
+}
+
+//moveTmpFile returns the file a staged plot is copied to before it is renamed to its final name in the farm dir
+func moveTmpFile(src, farmDir string) string {
+	return filepath.Join(farmDir, filepath.Base(src)+".tmp")
+}
+
+//move moves the staged plot to the farm dir and records the result
+func (m *mover) move(mv *plotMove, fd *FarmDir) {
+	tmp := moveTmpFile(mv.src, fd.dirStr)
+	logF("moving %s (%s) to %s\n", mv.src, mv.size, fd.dirStr)
+	err := movePlot(mv.src, fd.dirStr, getEnv().MoveChecksum, &mv.copied)
+	fd.rmMove(tmp)
+
+	m.mu.Lock()
+	mv.farmDir = nil
+	if err == nil {
+		delete(m.moves, mv.src)
+		m.mu.Unlock()
+		logF("moved %s to %s in %s\n", filepath.Base(mv.src), fd.dirStr, time.Since(mv.started).Truncate(time.Second))
+		metrics.PlotsMoved.Inc(fd.dirStr)
+		// the runner lock is taken before the mover lock, so the callback runs without it
+		if m.onMoved != nil {
+			m.onMoved(mv.src, filepath.Join(fd.dirStr, filepath.Base(mv.src)))
+		}
+		return
+	}
+	defer m.mu.Unlock()
+	mv.attempts++
+	mv.err = err.Error()
+	mv.retryAt = time.Now().Add(getEnv().MoveRetry())
+	metrics.MoveFailures.Inc(fd.dirStr)
+	logErrF("could not move %s to %s, attempt %d: %v\n", mv.src, fd.dirStr, mv.attempts, err)
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, errPlotExists) {
+		fd.ReportIOError(err.Error())
+	}
+	// only the first failure is sent, the move is retried until it succeeds
+	if mv.attempts == 1 {
+		Notify(EventMoveFailed, 0, fmt.Sprintf("could not move plot %s", filepath.Base(mv.src)),
+			fmt.Sprintf("could not move %s to %s:\n%v\n\nthe move is retried at %s",
+				mv.src, fd.dirStr, err, mv.retryAt.Format(time.RFC3339)))
+	}
+}
+
+//Statuses returns the status of all staged plots, oldest first
+func (m *mover) Statuses() []MoveStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := make([]MoveStatus, 0, len(m.moves))
+	for _, mv := range m.moves {
+		st := MoveStatus{
+			PlotFile: mv.src,
+			Size:     mv.size,
+			Attempts: mv.attempts,
+			Error:    mv.err,
+			RetryAt:  mv.retryAt,
+		}
+		if mv.farmDir != nil {
+			st.FarmDir = mv.farmDir.dirStr
+			st.Copied = ByteSz(atomic.LoadInt64(&mv.copied))
+			st.Started = mv.started
+		}
+		out = append(out, st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].PlotFile < out[j].PlotFile
+	})
+	return out
+}
+
+//Pending returns the number of staged plots that wait to be moved and have no farm dir reserved yet
+func (m *mover) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, mv := range m.moves {
+		if mv.farmDir == nil {
+			n++
+		}
+	}
+	return n
+}
+
+//Active returns the number of plots being moved
+func (m *mover) Active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, mv := range m.moves {
+		if mv.farmDir != nil {
+			n++
+		}
+	}
+	return n
+}
+
+//movePlot moves the plot file to the farm dir
+// a plot on the same file system is renamed, otherwise it is copied to a .tmp file that is checked against the
+// source and renamed once complete, so the farmer never sees a partial plot
+// copied is updated with the bytes copied so far
+func movePlot(src, farmDir string, checksum bool, copied *int64) error {
+	dst := filepath.Join(farmDir, filepath.Base(src))
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("%w: %s", errPlotExists, dst)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		fi, _ := os.Stat(dst)
+		if fi != nil {
+			atomic.StoreInt64(copied, fi.Size())
+		}
+		return nil
+	}
+
+	tmp := moveTmpFile(src, farmDir)
+	sum, err := copyPlot(src, tmp, copied)
+	if err == nil {
+		err = checkCopy(src, tmp, checksum, sum)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(src)
+}
+
+//copyPlot copies the file to dst, syncs it and returns the checksum of the data copied
+func copyPlot(src, dst string, copied *int64) (uint32, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	h := crc32.New(crcTable)
+	w := &progressWriter{w: io.MultiWriter(out, h), n: copied, name: filepath.Base(src), next: time.Now().Add(moveLogInterval)}
+	if _, err = io.CopyBuffer(w, in, make([]byte, moveBufferSize)); err != nil {
+		out.Close()
+		return 0, err
+	}
+	if err = out.Sync(); err != nil {
+		out.Close()
+		return 0, err
+	}
+	return h.Sum32(), out.Close()
+}
+
+//checkCopy checks that the copy has the size of the source and, if checksum is set, that its data read back from
+// the disk has the checksum of the data copied
+func checkCopy(src, dst string, checksum bool, sum uint32) error {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	dstInfo, err := os.Stat(dst)
+	if err != nil {
+		return err
+	}
+	if srcInfo.Size() != dstInfo.Size() {
+		return fmt.Errorf("copy of %s has %s, the plot has %s", src, ByteSz(dstInfo.Size()), ByteSz(srcInfo.Size()))
+	}
+	if !checksum {
+		return nil
+	}
+	got, err := fileChecksum(dst, crc32.New(crcTable))
+	if err != nil {
+		return err
+	}
+	if got != sum {
+		return fmt.Errorf("checksum of the copy of %s is %08x, the plot has %08x", src, got, sum)
+	}
+	return nil
+}
+
+//fileChecksum returns the checksum of the file using the given hash
+func fileChecksum(file string, h hash.Hash32) (uint32, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err = io.CopyBuffer(h, f, make([]byte, moveBufferSize)); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+//progressWriter counts the bytes written through it and logs the progress of the copy now and then
+type progressWriter struct {
+	w    io.Writer
+	n    *int64
+	name string
+	next time.Time
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	total := atomic.AddInt64(p.n, int64(n))
+	if now := time.Now(); now.After(p.next) {
+		p.next = now.Add(moveLogInterval)
+		logF("moving %s: %s copied\n", p.name, ByteSz(total))
+	}
+	return n, err
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMover(t *testing.T) {
+	tmp := t.TempDir()
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{MaxMovesPerDir: 1, MoveRetryMinutes: 5, MoveChecksum: true})
+
+	stagingPath, farmPath := filepath.Join(tmp, "staging"), filepath.Join(tmp, "farm")
+	for _, d := range []string{stagingPath, farmPath} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats := fakeStats{stagingPath: FarmPlotSpace * 10, farmPath: FarmPlotSpace * 2}
+	staging := NewFarmDir(stagingPath)
+	staging.stat = stats.stat
+	fd := NewFarmDir(farmPath)
+	fd.stat = stats.stat
+	pool := &FarmPool{mu: &sync.RWMutex{}}
+	pool.AddDirs(fd)
+	m := newMover(staging, pool, newReplotter(), newPlotTracker())
+	r := &Runner{FarmPool: pool, staging: staging, mover: m}
+	moved := make(chan string, 2)
+	m.onMoved = func(src, dst string) {
+		moved <- src + " -> " + dst
+	}
+
+	running := filepath.Join(stagingPath, "plot-k32-2021-06-01-08-00-aaaa.plot")
+	finished := filepath.Join(stagingPath, "plot-k32-2021-06-01-09-00-bbbb.plot")
+	for _, f := range []string{running, finished} {
+		if err := os.WriteFile(f, []byte(filepath.Base(f)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	staging.AddPID(1)
+	staging.SetPlotID(1, "aaaa")
+
+	// the running plot and the staged plot take up the space of both plots the farm dir has room for
+	m.moves[finished] = &plotMove{src: finished}
+	if _, err := r.nextFarmDir(); err != ErrMaxProcessesReached {
+		t.Errorf("expected the farm dirs to be full with the staged plots, got %v", err)
+	}
+	delete(m.moves, finished)
+	stats[farmPath] = FarmPlotSpace * 3
+	if sd, err := r.nextFarmDir(); err != nil || sd != staging {
+		t.Errorf("expected the staging dir, got %v %v", sd, err)
+	}
+
+	m.schedule()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Active() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := m.Statuses(); len(st) != 0 {
+		t.Fatalf("expected all staged plots moved, got %v", st)
+	}
+	if _, err := os.Stat(filepath.Join(farmPath, filepath.Base(finished))); err != nil {
+		t.Errorf("expected the finished plot in the farm dir: %v", err)
+	}
+	if _, err := os.Stat(running); err != nil {
+		t.Errorf("expected the running plot to stay in the staging dir: %v", err)
+	}
+	if fd.Moves() != 0 {
+		t.Errorf("expected no moves left in the farm dir, got %d", fd.Moves())
+	}
+	expect := finished + " -> " + filepath.Join(farmPath, filepath.Base(finished))
+	if got := <-moved; got != expect || len(moved) != 0 {
+		t.Errorf("expected the move %s to be reported once, got %s", expect, got)
+	}
+}
+
+func TestStagedPlots(t *testing.T) {
+	stagingPath := t.TempDir()
+	staging := NewFarmDir(stagingPath)
+	tracker := newPlotTracker()
+	m := newMover(staging, &FarmPool{mu: &sync.RWMutex{}}, newReplotter(), tracker)
+
+	old := filepath.Join(stagingPath, "plot-k32-2021-06-01-08-00-aaaa.plot")
+	recent := filepath.Join(stagingPath, "plot-k32-2021-06-01-09-00-bbbb.plot")
+	for _, f := range []string{old, recent} {
+		if err := os.WriteFile(f, []byte(filepath.Base(f)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a plot started an hour ago has no plot ID yet, only the file written since it started may be its own
+	progress := newPlotProgress(chiaPlotter{})
+	progress.StartTime = time.Now().Add(-time.Hour)
+	tracker.Add(1, progress)
+	staging.AddPID(1)
+	if err := os.Chtimes(old, progress.StartTime.Add(-time.Hour), progress.StartTime.Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if staged, ok := m.stagedPlots(); !ok || len(staged) != 1 || staged[0] != old {
+		t.Errorf("expected only %s staged, got %v", old, staged)
+	}
+
+	staging.SetPlotID(1, "cccc")
+	if staged, _ := m.stagedPlots(); len(staged) != 2 {
+		t.Errorf("expected both plots staged once the plot ID is known, got %v", staged)
+	}
+}
+
+func TestCheckCopy(t *testing.T) {
+	tmp := t.TempDir()
+	src, dst := filepath.Join(tmp, "src.plot"), filepath.Join(tmp, "dst.plot.tmp")
+	if err := os.WriteFile(src, []byte("plot data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var copied int64
+	sum, err := copyPlot(src, dst, &copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied != int64(len("plot data")) {
+		t.Errorf("expected %d bytes copied, got %d", len("plot data"), copied)
+	}
+	if err = checkCopy(src, dst, true, sum); err != nil {
+		t.Errorf("expected the copy to match: %v", err)
+	}
+
+	// a copy with the right size but other data is only caught by the checksum
+	if err = os.WriteFile(dst, []byte("plot dat4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = checkCopy(src, dst, false, sum); err != nil {
+		t.Errorf("expected the size to match: %v", err)
+	}
+	if err = checkCopy(src, dst, true, sum); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+
+	if err = os.WriteFile(dst, []byte("plot"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = checkCopy(src, dst, false, sum); err == nil {
+		t.Error("expected a size mismatch")
+	}
+}
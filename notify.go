@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+//EventType is the type of a notification event
+type EventType string
+
+const (
+	EventPlotStarted  EventType = "plot_started"
+	EventPlotFinished EventType = "plot_finished"
+	EventPlotFailed   EventType = "plot_failed"
+	EventFatal        EventType = "fatal"
+	EventDiskLow      EventType = "disk_low"
+	EventStaleTemp    EventType = "stale_temp"
+	EventDirHealth    EventType = "dir_health"
+	EventMoveFailed   EventType = "move_failed"
+
+	// EventAny is the route key matching every event type without its own route
+	EventAny = "*"
+
+	NotifierEmail   = "email"
+	NotifierWebhook = "webhook"
+	NotifierCommand = "command"
+	NotifierLog     = "log"
+
+	notifyTimeout = 30 * time.Second
+)
+
+//eventTypes are the types of all events notifications are sent for
+var eventTypes = []EventType{EventPlotStarted, EventPlotFinished, EventPlotFailed, EventFatal, EventDiskLow,
+	EventStaleTemp, EventDirHealth, EventMoveFailed}
+
+//validRouteKey returns true if the notification route key is an event type or *
+func validRouteKey(key string) bool {
+	if key == EventAny {
+		return true
+	}
+	for _, t := range eventTypes {
+		if key == string(t) {
+			return true
+		}
+	}
+	return false
+}
+
+//Event is a notification sent through one or more Notifiers
+type Event struct {
+	Type    EventType
+	Subject string
+	Body    string
+	Time    time.Time
+	PID     int `json:",omitempty"`
+}
+
+//Notifier sends notifications through a single channel
+type Notifier interface {
+	//Name returns the name of the channel as used in the notification routes
+	Name() string
+	//Notify sends the event
+	Notify(e Event) error
+}
+
+//notifyConfig configures the notification channels and which events are routed to which channels
+type notifyConfig struct {
+	WebhookURL string
+	Command    []string
+	// Routes maps event types, or * for all other events, to notifier names
+	Routes map[string][]string
+}
+
+//emailNotifier sends events as emails through the configured SMTP server
+type emailNotifier struct{}
+
+func (emailNotifier) Name() string {
+	return NotifierEmail
+}
+
+func (emailNotifier) Notify(e Event) error {
+	if err := sendEmail(e.Subject, e.Body); err != nil {
+		metrics.EmailFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+//webhookNotifier posts events as JSON to a URL
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (w webhookNotifier) Name() string {
+	return NotifierWebhook
+}
+
+func (w webhookNotifier) Notify(e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s responded with %s", w.url, resp.Status)
+	}
+	return nil
+}
+
+//commandNotifier runs a local command for every event
+// the event type and subject are passed as environment variables and the body on stdin
+type commandNotifier struct {
+	command []string
+}
+
+func (c commandNotifier) Name() string {
+	return NotifierCommand
+}
+
+func (c commandNotifier) Notify(e Event) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.command[0], c.command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"CHIARUNNER_EVENT="+string(e.Type),
+		"CHIARUNNER_SUBJECT="+e.Subject,
+		fmt.Sprintf("CHIARUNNER_PID=%d", e.PID))
+	cmd.Stdin = bytes.NewBufferString(e.Body)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("notify command failed: %v: %s", err, out)
+	}
+	return nil
+}
+
+//logNotifier writes events to the log
+type logNotifier struct{}
+
+func (logNotifier) Name() string {
+	return NotifierLog
+}
+
+func (logNotifier) Notify(e Event) error {
+	logF("[%s] %s\n", e.Type, e.Subject)
+	return nil
+}
+
+//newNotifier returns the Notifier with the given name configured from the given env
+func newNotifier(name string, e *envVars) (Notifier, error) {
+	switch name {
+	case NotifierEmail:
+		if len(e.SMTPHost) == 0 {
+			return nil, fmt.Errorf("email notifier requires SMTPHost")
+		}
+		return emailNotifier{}, nil
+	case NotifierWebhook:
+		if len(e.Notify.WebhookURL) == 0 {
+			return nil, fmt.Errorf("webhook notifier requires Notify.WebhookURL")
+		}
+		return webhookNotifier{url: e.Notify.WebhookURL, client: &http.Client{Timeout: notifyTimeout}}, nil
+	case NotifierCommand:
+		if len(e.Notify.Command) == 0 {
+			return nil, fmt.Errorf("command notifier requires Notify.Command")
+		}
+		return commandNotifier{command: e.Notify.Command}, nil
+	case NotifierLog:
+		return logNotifier{}, nil
+	}
+	return nil, fmt.Errorf("unknown notifier %q", name)
+}
+
+//defaultRoutes routes all events by email if SMTP is configured, otherwise to the log
+func defaultRoutes(e *envVars) map[string][]string {
+	if len(e.SMTPHost) > 0 {
+		return map[string][]string{EventAny: {NotifierEmail}}
+	}
+	return map[string][]string{EventAny: {NotifierLog}}
+}
+
+//notifiersFor returns the Notifiers the given event type is routed to
+func notifiersFor(t EventType, e *envVars) []Notifier {
+	routes := e.Notify.Routes
+	if len(routes) == 0 {
+		routes = defaultRoutes(e)
+	}
+	names, ok := routes[string(t)]
+	if !ok {
+		names = routes[EventAny]
+	}
+	notifiers := make([]Notifier, 0, len(names))
+	for _, name := range names {
+		n, err := newNotifier(name, e)
+		if err != nil {
+			logErrF("invalid notification route for %s: %v\n", t, err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers
+}
+
+//dispatch sends the event through all notifiers it is routed to and returns once all are done
+func dispatch(e Event) {
+	env := getEnv()
+	if env == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, n := range notifiersFor(e.Type, env) {
+		wg.Add(1)
+		go func(n Notifier) {
+			defer wg.Done()
+			if err := n.Notify(e); err != nil {
+				logErrLn("Failed sending", n.Name(), "notification:", err)
+				metrics.NotifyFailures.Inc(n.Name())
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+//Notify sends a notification of the given event type in the background
+func Notify(t EventType, pid int, subject, body string) {
+	go dispatch(Event{Type: t, Subject: subject, Body: body, Time: time.Now(), PID: pid})
+}
+
+//NotifySync sends a notification of the given event type and waits until it has been sent
+func NotifySync(t EventType, pid int, subject, body string) {
+	dispatch(Event{Type: t, Subject: subject, Body: body, Time: time.Now(), PID: pid})
+}
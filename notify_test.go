@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	events := make(chan Event, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var e Event
+		if err := json.NewDecoder(req.Body).Decode(&e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		events <- e
+	}))
+	defer srv.Close()
+
+	n, err := newNotifier(NotifierWebhook, &envVars{Notify: notifyConfig{WebhookURL: srv.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent := Event{Type: EventPlotFinished, Subject: "plot process 1 finished", Body: "body", Time: time.Now().UTC(), PID: 1}
+	if err = n.Notify(sent); err != nil {
+		t.Fatal(err)
+	}
+	got := <-events
+	if got.Type != sent.Type || got.Subject != sent.Subject || got.Body != sent.Body || got.PID != sent.PID ||
+		!got.Time.Equal(sent.Time) {
+		t.Errorf("expected event %+v, got %+v", sent, got)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+	n, _ = newNotifier(NotifierWebhook, &envVars{Notify: notifyConfig{WebhookURL: failing.URL}})
+	if err = n.Notify(sent); err == nil {
+		t.Error("expected an error from a failing webhook")
+	}
+}
+
+func TestCommandNotifier(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "out")
+	n, err := newNotifier(NotifierCommand, &envVars{Notify: notifyConfig{
+		Command: []string{"sh", "-c", `printf "%s|%s|" "$CHIARUNNER_EVENT" "$CHIARUNNER_SUBJECT" > ` + out + ` && cat >> ` + out},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = n.Notify(Event{Type: EventDiskLow, Subject: "no space", Body: "body"}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "disk_low|no space|body" {
+		t.Errorf("unexpected command output %q", b)
+	}
+}
+
+func TestNotifiersFor(t *testing.T) {
+	e := &envVars{
+		SMTPHost: "smtp.example.com",
+		Notify: notifyConfig{
+			WebhookURL: "http://127.0.0.1/hook",
+			Routes: map[string][]string{
+				string(EventPlotFailed): {NotifierEmail, NotifierWebhook},
+				EventAny:                {NotifierLog},
+			},
+		},
+	}
+	names := func(t EventType) string {
+		var out []string
+		for _, n := range notifiersFor(t, e) {
+			out = append(out, n.Name())
+		}
+		return strings.Join(out, ",")
+	}
+	if got := names(EventPlotFailed); got != "email,webhook" {
+		t.Errorf("expected plot_failed to route to email,webhook, got %s", got)
+	}
+	if got := names(EventPlotStarted); got != "log" {
+		t.Errorf("expected plot_started to route to log, got %s", got)
+	}
+
+	e.Notify.Routes = nil
+	if got := names(EventPlotStarted); got != "email" {
+		t.Errorf("expected default route to email, got %s", got)
+	}
+}
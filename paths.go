@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+//defaultChiaDirs are the dirs searched for the chia venv activate script if ChiaDir is not set
+var defaultChiaDirs = []string{
+	"~/chia-blockchain",
+	"~/chia-blockchain/venv/bin",
+}
+
+//expandPath expands $VAR and ${VAR} environment variables and a leading ~ to the home dir of the current user
+func expandPath(p string) string {
+	p = os.ExpandEnv(p)
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, p[1:])
+}
+
+//expandPaths expands all paths in the given slice in place
+func expandPaths(paths []string) {
+	for i, p := range paths {
+		paths[i] = expandPath(p)
+	}
+}
+
+//expandEnvPaths expands all paths of the env
+func expandEnvPaths(e *envVars) {
+	e.ChiaDir = expandPath(e.ChiaDir)
+	e.LogFile = expandPath(e.LogFile)
+	e.TempDir2 = expandPath(e.TempDir2)
+	e.MadmaxPath = expandPath(e.MadmaxPath)
+	e.BladebitPath = expandPath(e.BladebitPath)
+	e.StateFile = expandPath(e.StateFile)
+	e.HistoryFile = expandPath(e.HistoryFile)
+	e.PlotLogDir = expandPath(e.PlotLogDir)
+	e.QuarantineDir = expandPath(e.QuarantineDir)
+	e.StagingDir = expandPath(e.StagingDir)
+	expandPaths(e.PlotDirs)
+	expandPaths(e.FarmDirs)
+	if len(e.PlotDirPlotters) > 0 {
+		plotters := make(map[string]string, len(e.PlotDirPlotters))
+		for d, name := range e.PlotDirPlotters {
+			plotters[expandPath(d)] = name
+		}
+		e.PlotDirPlotters = plotters
+	}
+	e.DirPriorities = expandKeys(e.DirPriorities)
+	e.DirMaxConcurrent = expandKeys(e.DirMaxConcurrent)
+	for i := range e.PlotDirConfigs {
+		e.PlotDirConfigs[i].Path = expandPath(e.PlotDirConfigs[i].Path)
+		e.PlotDirConfigs[i].SecondTempDir = expandPath(e.PlotDirConfigs[i].SecondTempDir)
+	}
+	for i := range e.FarmDirConfigs {
+		e.FarmDirConfigs[i].Path = expandPath(e.FarmDirConfigs[i].Path)
+	}
+}
+
+//expandKeys returns the per dir settings with the dir paths used as keys expanded
+func expandKeys(m map[string]int) map[string]int {
+	if len(m) == 0 {
+		return m
+	}
+	out := make(map[string]int, len(m))
+	for d, v := range m {
+		out[expandPath(d)] = v
+	}
+	return out
+}
+
+//detectChiaDir returns the first of the default chia dirs containing an activate script
+// an empty dir is returned if there is none, chia is then run from the PATH
+func detectChiaDir() string {
+	for _, d := range defaultChiaDirs {
+		d = expandPath(d)
+		if _, err := os.Stat(filepath.Join(d, "activate")); err == nil {
+			return d
+		}
+	}
+	return ""
+}
+
+//chiaInstall describes the chia install the given env uses, or returns an empty string if there is none
+func chiaInstall(e *envVars) string {
+	if len(e.ChiaDir) > 0 {
+		return "venv activated by " + filepath.Join(e.ChiaDir, "activate")
+	}
+	if p, err := exec.LookPath("chia"); err == nil {
+		return p + " on the PATH"
+	}
+	return ""
+}
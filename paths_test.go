@@ -0,0 +1,50 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandPath(t *testing.T) {
+	home := t.TempDir()
+	for k, v := range map[string]string{"HOME": home, "PLOT_DISK": "/mnt/plot1"} {
+		prev, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, prev)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	tests := map[string]string{
+		"":                        "",
+		"~":                       home,
+		"~/chia-blockchain":       filepath.Join(home, "chia-blockchain"),
+		"$HOME/chia-blockchain":   filepath.Join(home, "chia-blockchain"),
+		"${PLOT_DISK}/tmp":        "/mnt/plot1/tmp",
+		"/mnt/~farm":              "/mnt/~farm",
+		"~other/chia-blockchain":  "~other/chia-blockchain",
+		"/var/log/chiarunner.log": "/var/log/chiarunner.log",
+	}
+	for p, expected := range tests {
+		if got := expandPath(p); got != expected {
+			t.Errorf("expandPath(%q): expected %q, got %q", p, expected, got)
+		}
+	}
+
+	if d := detectChiaDir(); len(d) > 0 {
+		t.Errorf("expected no chia dir in an empty home, got %s", d)
+	}
+	chiaDir := filepath.Join(home, "chia-blockchain")
+	if err := os.MkdirAll(chiaDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chiaDir, "activate"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if d := detectChiaDir(); d != chiaDir {
+		t.Errorf("expected chia dir %s, got %s", chiaDir, d)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+const (
+	PlotterChia     = "chia"
+	PlotterMadmax   = "madmax"
+	PlotterBladebit = "bladebit"
+)
+
+//PlotJob describes a single plot to be created by a Plotter
+type PlotJob struct {
+	TempDir  string
+	TempDir2 string
+	FarmDir  string
+	Threads  int
+	MemMB    int
+	Buckets  int
+	// Keys are the keys the plot is created with
+	Keys PlotKeys
+}
+
+//Plotter is a plotting backend that creates plots
+type Plotter interface {
+	//Name returns the name of the plotter as used in the config
+	Name() string
+	//Args returns the arguments the plotter binary is run with to create the plot described by the PlotJob
+	Args(job PlotJob) []string
+	//Cmd returns the command that creates the plot described by the PlotJob
+	Cmd(job PlotJob) *exec.Cmd
+	//TempSpace returns the peak temp dir space used by a single plot
+	TempSpace() ByteSz
+	//TempSpace2 returns the peak second temp dir space used by a single plot
+	TempSpace2() ByteSz
+	//Memory returns the RAM used by a single plot
+	Memory() ByteSz
+	//ParseLine updates the given progress from a single line of the plotter output
+	// the caller must hold the progress lock
+	ParseLine(p *PlotProgress, line string)
+}
+
+//newPlotter returns the Plotter with the given name
+func newPlotter(name string) (Plotter, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", PlotterChia:
+		return chiaPlotter{}, nil
+	case PlotterMadmax, "chia_plot":
+		return madmaxPlotter{}, nil
+	case PlotterBladebit:
+		return bladebitPlotter{}, nil
+	}
+	return nil, fmt.Errorf("unknown plotter %q", name)
+}
+
+//plotterName returns the name of the plotter the given env configures for the given plot dir
+// PlotDirPlotters keys may be glob patterns, an exact match takes precedence
+func plotterName(e *envVars, plotDir string) string {
+	keys := make([]string, 0, len(e.PlotDirPlotters))
+	for k := range e.PlotDirPlotters {
+		keys = append(keys, k)
+	}
+	if k, ok := dirKey(plotDir, keys); ok {
+		return e.PlotDirPlotters[k]
+	}
+	return e.Plotter
+}
+
+//plotterFor returns the Plotter configured for the given plot dir, falling back to the global Plotter
+func plotterFor(plotDir string) Plotter {
+	plotter, err := newPlotter(plotterName(getEnv(), plotDir))
+	if err != nil {
+		logFatalF("invalid plotter for plot dir %s: %v", plotDir, err)
+	}
+	return plotter
+}
+
+//dirArg returns the dir with a trailing path separator as some plotters expect
+func dirArg(dir string) string {
+	if strings.HasSuffix(dir, "/") {
+		return dir
+	}
+	return dir + "/"
+}
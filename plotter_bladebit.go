@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+var (
+	BladebitPlotMemory = ByteSzFromGiB(416)
+
+	reBladebitPlotID     = regexp.MustCompile(`^Generating plot \d+ / \d+: ([0-9a-fA-F]{64})`)
+	reBladebitPhaseStart = regexp.MustCompile(`^Running Phase (\d)`)
+	reBladebitPhaseTime  = regexp.MustCompile(`^Finished Phase (\d) in ([\d.]+) seconds`)
+	reBladebitForward    = regexp.MustCompile(`^\s*Forward propagating to table (\d)`)
+	reBladebitCompress   = regexp.MustCompile(`^\s*Compressing tables (\d) and (\d)`)
+	reBladebitWrite      = regexp.MustCompile(`^Writing final plot tables to disk`)
+	reBladebitWriteTime  = regexp.MustCompile(`^Finished writing tables to disk in ([\d.]+) seconds`)
+	reBladebitTotalTime  = regexp.MustCompile(`^Finished plotting in ([\d.]+) seconds`)
+)
+
+//bladebitPlotter is the Plotter using the in-memory bladebit plotter
+// bladebit does not use a temp dir and writes the plot directly to the farm dir
+type bladebitPlotter struct{}
+
+func (bladebitPlotter) Name() string {
+	return PlotterBladebit
+}
+
+//Args returns the arguments of `bladebit` creating a single plot
+func (bladebitPlotter) Args(job PlotJob) []string {
+	args := []string{
+		"-n", "1",
+		"-t", fmt.Sprintf("%d", job.Threads),
+	}
+	// bladebit takes the farm dir last
+	args = append(args, job.Keys.args(false)...)
+	return append(args, job.FarmDir)
+}
+
+//Cmd returns the `bladebit` command for a single plot
+func (p bladebitPlotter) Cmd(job PlotJob) *exec.Cmd {
+	return exec.Command(getEnv().BladebitPath, p.Args(job)...)
+}
+
+func (bladebitPlotter) TempSpace() ByteSz {
+	return 0
+}
+
+func (bladebitPlotter) TempSpace2() ByteSz {
+	return 0
+}
+
+func (bladebitPlotter) Memory() ByteSz {
+	return BladebitPlotMemory
+}
+
+//ParseLine updates the given progress from a line of `bladebit` output
+func (bladebitPlotter) ParseLine(p *PlotProgress, line string) {
+	var m []string
+	if m = reBladebitPlotID.FindStringSubmatch(line); m != nil {
+		p.PlotID = m[1]
+		return
+	}
+	if m = reBladebitPhaseStart.FindStringSubmatch(line); m != nil {
+		phase, _ := strconv.Atoi(m[1])
+		p.setPhase(phase)
+		p.setPercent(0, 1, 0)
+		return
+	}
+	if m = reBladebitPhaseTime.FindStringSubmatch(line); m != nil {
+		phase, _ := strconv.Atoi(m[1])
+		if phase >= 1 && phase <= 4 {
+			p.PhaseTimes[phase-1] = parseSeconds(m[2])
+			p.setPercent(1, 1, 0)
+		}
+		return
+	}
+	if reBladebitWrite.MatchString(line) {
+		p.setPhase(PhaseCopy)
+		p.Percent = 100
+		return
+	}
+	if m = reBladebitWriteTime.FindStringSubmatch(line); m != nil {
+		p.CopyTime = parseSeconds(m[1])
+		return
+	}
+	if m = reBladebitTotalTime.FindStringSubmatch(line); m != nil {
+		p.TotalTime = parseSeconds(m[1])
+		p.setPhase(PhaseDone)
+		p.Percent = 100
+		return
+	}
+	if m = reBladebitForward.FindStringSubmatch(line); m != nil && p.Phase == 1 {
+		p.Table, _ = strconv.Atoi(m[1])
+		p.setPercent(p.Table-1, 7, 0)
+		return
+	}
+	if m = reBladebitCompress.FindStringSubmatch(line); m != nil && p.Phase == 3 {
+		p.Table, _ = strconv.Atoi(m[2])
+		p.setPercent(p.Table-2, 6, 0)
+	}
+}
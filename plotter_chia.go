@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+var (
+	reChiaPhaseStart = regexp.MustCompile(`^Starting phase (\d)/4`)
+	reChiaPhaseTime  = regexp.MustCompile(`^Time for phase (\d) = ([\d.]+) seconds`)
+	reChiaTotalTime  = regexp.MustCompile(`^Total time = ([\d.]+) seconds`)
+	reChiaCopyTime   = regexp.MustCompile(`^Copy time = ([\d.]+) seconds`)
+	reChiaBuckets    = regexp.MustCompile(`^Using (\d+) buckets`)
+	reChiaID         = regexp.MustCompile(`^ID: ([0-9a-fA-F]{64})`)
+	reChiaComputing  = regexp.MustCompile(`^Computing table (\d)`)
+	reChiaBackprop   = regexp.MustCompile(`^Backpropagating on table (\d)`)
+	reChiaCompress   = regexp.MustCompile(`^Compressing tables (\d) and (\d)`)
+	reChiaWriteC1    = regexp.MustCompile(`^\s*Starting to write C1 and C3 tables`)
+	reChiaBucket     = regexp.MustCompile(`^\s*Bucket (\d+) `)
+	reChiaRenamed    = regexp.MustCompile(`^Renamed final file`)
+)
+
+//chiaPlotter is the Plotter using the reference `chia plots create` plotter
+type chiaPlotter struct{}
+
+func (chiaPlotter) Name() string {
+	return PlotterChia
+}
+
+//Args returns the arguments of `chia` creating a single plot
+func (chiaPlotter) Args(job PlotJob) []string {
+	args := []string{
+		"plots",
+		"create",
+		"-k", "32",
+		"-r", fmt.Sprintf("%d", job.Threads),
+		"-b", fmt.Sprintf("%d", job.MemMB),
+		"-t", job.TempDir,
+		"-d", job.FarmDir,
+	}
+	if len(job.TempDir2) > 0 {
+		args = append(args, "-2", job.TempDir2)
+	}
+	if job.Buckets > 0 {
+		args = append(args, "-u", fmt.Sprintf("%d", job.Buckets))
+	}
+	return append(args, job.Keys.args(true)...)
+}
+
+//Cmd returns the `chia plots create` command run inside the chia venv
+func (p chiaPlotter) Cmd(job PlotJob) *exec.Cmd {
+	shellCmd := newChiaBaseCmd()
+	shellCmd.AddCmd(exec.Command("chia", p.Args(job)...))
+	return shellCmd.Cmd()
+}
+
+func (chiaPlotter) TempSpace() ByteSz {
+	return TmpPlotSpace
+}
+
+//TempSpace2 returns the space of the final plot file, which chia writes to the second temp dir in phase 3 and 4
+func (chiaPlotter) TempSpace2() ByteSz {
+	return FarmPlotSpace
+}
+
+func (chiaPlotter) Memory() ByteSz {
+	return getEnv().PerPlotMem()
+}
+
+func (chiaPlotter) ParseLine(p *PlotProgress, line string) {
+	parseChiaLine(p, line)
+}
+
+//parseChiaLine updates the given progress from a line of `chia plots create` output
+// the caller must hold the progress lock
+func parseChiaLine(p *PlotProgress, line string) {
+	var m []string
+	if m = reChiaPhaseStart.FindStringSubmatch(line); m != nil {
+		phase, _ := strconv.Atoi(m[1])
+		p.setPhase(phase)
+		p.setPercent(0, 1, 0)
+		return
+	}
+	if m = reChiaPhaseTime.FindStringSubmatch(line); m != nil {
+		phase, _ := strconv.Atoi(m[1])
+		if phase >= 1 && phase <= 4 {
+			p.PhaseTimes[phase-1] = parseSeconds(m[2])
+			p.setPercent(1, 1, 0)
+		}
+		return
+	}
+	if m = reChiaTotalTime.FindStringSubmatch(line); m != nil {
+		p.TotalTime = parseSeconds(m[1])
+		p.setPhase(PhaseCopy)
+		p.Percent = 100
+		return
+	}
+	if m = reChiaCopyTime.FindStringSubmatch(line); m != nil {
+		p.CopyTime = parseSeconds(m[1])
+		return
+	}
+	if reChiaRenamed.MatchString(line) {
+		p.setPhase(PhaseDone)
+		return
+	}
+	if m = reChiaID.FindStringSubmatch(line); m != nil {
+		p.PlotID = m[1]
+		return
+	}
+	if m = reChiaBuckets.FindStringSubmatch(line); m != nil {
+		p.Buckets, _ = strconv.Atoi(m[1])
+		return
+	}
+	if m = reChiaComputing.FindStringSubmatch(line); m != nil && p.Phase == 1 {
+		p.Table, _ = strconv.Atoi(m[1])
+		p.Bucket = 0
+		p.setPercent(p.Table-1, 7, 0)
+		return
+	}
+	if m = reChiaBackprop.FindStringSubmatch(line); m != nil && p.Phase == 2 {
+		p.Table, _ = strconv.Atoi(m[1])
+		p.Bucket = 0
+		// back propagation runs from table 7 down to table 2
+		p.setPercent(7-p.Table, 6, 0)
+		return
+	}
+	if m = reChiaCompress.FindStringSubmatch(line); m != nil && p.Phase == 3 {
+		p.Table, _ = strconv.Atoi(m[2])
+		p.Bucket = 0
+		p.setPercent(p.Table-2, 6, 0)
+		return
+	}
+	if reChiaWriteC1.MatchString(line) && p.Phase == 4 {
+		p.setPercent(0, 1, 0)
+		return
+	}
+	if m = reChiaBucket.FindStringSubmatch(line); m != nil {
+		p.Bucket, _ = strconv.Atoi(m[1])
+		p.Bucket++
+		switch p.Phase {
+		case 1:
+			if p.Table > 0 {
+				p.setPercent(p.Table-1, 7, p.bucketFraction())
+			}
+		case 3:
+			if p.Table > 1 {
+				p.setPercent(p.Table-2, 6, p.bucketFraction())
+			}
+		case 4:
+			p.setPercent(0, 1, p.bucketFraction())
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+var (
+	MadmaxTmpPlotSpace  = ByteSzFromGiB(256)
+	MadmaxTmp2PlotSpace = ByteSzFromGiB(110)
+	MadmaxPlotMemory    = ByteSzFromGiB(4)
+
+	reMadmaxPlotName  = regexp.MustCompile(`^Plot Name: plot-k\d+-[\d-]+-([0-9a-fA-F]{64})`)
+	reMadmaxBuckets   = regexp.MustCompile(`^Number of Buckets P1:\s+2\^\d+ \((\d+)\)`)
+	reMadmaxP1Table   = regexp.MustCompile(`^\[P1\] Table (\d) took`)
+	reMadmaxP2Table   = regexp.MustCompile(`^\[P2\] Table (\d) rewrite took`)
+	reMadmaxP3Table   = regexp.MustCompile(`^\[P3-2\] Table (\d) took`)
+	reMadmaxP4C1      = regexp.MustCompile(`^\[P4\] Finished writing C1 and C3 tables`)
+	reMadmaxPhaseTime = regexp.MustCompile(`^Phase (\d) took ([\d.]+) sec`)
+	reMadmaxTotalTime = regexp.MustCompile(`^Total plot creation time was ([\d.]+) sec`)
+	reMadmaxCopyTime  = regexp.MustCompile(`^Copy to .* finished, took ([\d.]+) sec`)
+	reMadmaxRenamed   = regexp.MustCompile(`^Renamed final plot`)
+)
+
+//madmaxPlotter is the Plotter using madMAx's `chia_plot`
+type madmaxPlotter struct{}
+
+func (madmaxPlotter) Name() string {
+	return PlotterMadmax
+}
+
+//Args returns the arguments of `chia_plot` creating a single plot
+func (madmaxPlotter) Args(job PlotJob) []string {
+	args := []string{
+		"-n", "1",
+		"-r", fmt.Sprintf("%d", job.Threads),
+		"-t", dirArg(job.TempDir),
+		"-d", dirArg(job.FarmDir),
+	}
+	if len(job.TempDir2) > 0 {
+		args = append(args, "-2", dirArg(job.TempDir2))
+	}
+	if job.Buckets > 0 {
+		args = append(args, "-u", fmt.Sprintf("%d", job.Buckets))
+	}
+	return append(args, job.Keys.args(false)...)
+}
+
+//Cmd returns the `chia_plot` command for a single plot
+func (p madmaxPlotter) Cmd(job PlotJob) *exec.Cmd {
+	return exec.Command(getEnv().MadmaxPath, p.Args(job)...)
+}
+
+func (madmaxPlotter) TempSpace() ByteSz {
+	return MadmaxTmpPlotSpace
+}
+
+func (madmaxPlotter) TempSpace2() ByteSz {
+	return MadmaxTmp2PlotSpace
+}
+
+func (madmaxPlotter) Memory() ByteSz {
+	return MadmaxPlotMemory
+}
+
+//ParseLine updates the given progress from a line of `chia_plot` output
+// madMAx only logs when a step has finished, so phases start when the previous one is done
+func (madmaxPlotter) ParseLine(p *PlotProgress, line string) {
+	var m []string
+	if m = reMadmaxPlotName.FindStringSubmatch(line); m != nil {
+		p.PlotID = m[1]
+		p.setPhase(1)
+		return
+	}
+	if m = reMadmaxBuckets.FindStringSubmatch(line); m != nil {
+		p.Buckets, _ = strconv.Atoi(m[1])
+		return
+	}
+	if m = reMadmaxPhaseTime.FindStringSubmatch(line); m != nil {
+		phase, _ := strconv.Atoi(m[1])
+		if phase >= 1 && phase <= 4 {
+			p.PhaseTimes[phase-1] = parseSeconds(m[2])
+			p.setPercent(1, 1, 0)
+			if phase < 4 {
+				p.setPhase(phase + 1)
+			}
+		}
+		return
+	}
+	if m = reMadmaxTotalTime.FindStringSubmatch(line); m != nil {
+		p.TotalTime = parseSeconds(m[1])
+		p.setPhase(PhaseCopy)
+		p.Percent = 100
+		return
+	}
+	if m = reMadmaxCopyTime.FindStringSubmatch(line); m != nil {
+		p.CopyTime = parseSeconds(m[1])
+		p.setPhase(PhaseDone)
+		return
+	}
+	if reMadmaxRenamed.MatchString(line) {
+		p.setPhase(PhaseDone)
+		return
+	}
+	if m = reMadmaxP1Table.FindStringSubmatch(line); m != nil && p.Phase == 1 {
+		p.Table, _ = strconv.Atoi(m[1])
+		p.setPercent(p.Table, 7, 0)
+		return
+	}
+	if m = reMadmaxP2Table.FindStringSubmatch(line); m != nil && p.Phase == 2 {
+		// tables are rewritten from table 7 down to table 2
+		p.Table, _ = strconv.Atoi(m[1])
+		p.setPercent(8-p.Table, 6, 0)
+		return
+	}
+	if m = reMadmaxP3Table.FindStringSubmatch(line); m != nil && p.Phase == 3 {
+		p.Table, _ = strconv.Atoi(m[1])
+		p.setPercent(p.Table-1, 6, 0)
+		return
+	}
+	if reMadmaxP4C1.MatchString(line) && p.Phase == 4 {
+		p.setPercent(1, 2, 0)
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// PhaseCopy is the phase after the 4 plotting phases where the final plot file is copied to the farm dir
+	PhaseCopy = 5
+	// PhaseDone is the phase once the final plot file is in place
+	PhaseDone = 6
+
+	defaultBuckets = 128
+)
+
+var (
+	// phaseSpans are the approximate share of the total plotting time (in percent) spent in each phase
+	phaseSpans = [4]float64{42, 19, 37, 2}
+)
+
+//newPlotProgress creates a new PlotProgress started now for the given Plotter
+func newPlotProgress(plotter Plotter) *PlotProgress {
+	now := time.Now()
+	return &PlotProgress{
+		Plotter:    plotter.Name(),
+		StartTime:  now,
+		PhaseStart: now,
+		Buckets:    defaultBuckets,
+		parser:     plotter,
+		mu:         &sync.RWMutex{},
+	}
+}
+
+//PlotProgress is the progress record of a single plot process, built from the plotter's output
+type PlotProgress struct {
+	PID        int
+	Plotter    string
+	PlotID     string
+	Phase      int
+	Table      int
+	Bucket     int
+	Buckets    int
+	Percent    float64
+	StartTime  time.Time
+	PhaseStart time.Time
+	PhaseTimes [4]time.Duration
+	TotalTime  time.Duration
+	CopyTime   time.Duration
+	parser     Plotter
+	mu         *sync.RWMutex
+	PlotKeys
+}
+
+//SetPID sets the PID of the process the progress belongs to
+func (p *PlotProgress) SetPID(pid int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.PID = pid
+}
+
+//Snapshot returns a copy of the progress record that is safe to read
+func (p *PlotProgress) Snapshot() PlotProgress {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	s := *p
+	s.mu = nil
+	s.parser = nil
+	return s
+}
+
+//Elapsed returns the time elapsed since the plot was started
+func (p PlotProgress) Elapsed() time.Duration {
+	return time.Since(p.StartTime).Truncate(time.Second)
+}
+
+//PhaseElapsed returns the time elapsed in the current phase
+func (p PlotProgress) PhaseElapsed() time.Duration {
+	return time.Since(p.PhaseStart).Truncate(time.Second)
+}
+
+//PhaseString returns a human readable name of the current phase
+func (p PlotProgress) PhaseString() string {
+	switch {
+	case p.Phase == 0:
+		return "starting"
+	case p.Phase <= 4:
+		return fmt.Sprintf("phase %d/4", p.Phase)
+	case p.Phase == PhaseCopy:
+		return "copying"
+	default:
+		return "done"
+	}
+}
+
+//String returns a single line summary of the progress
+func (p PlotProgress) String() string {
+	s := fmt.Sprintf("[%d] %s %.1f%% elapsed %s (in phase %s)",
+		p.PID, p.PhaseString(), p.Percent, p.Elapsed(), p.PhaseElapsed())
+	if pool := p.Pool(); pool != "-" {
+		s += " pool " + pool
+	}
+	return s
+}
+
+//PhaseTimesString returns the durations of the completed phases
+func (p PlotProgress) PhaseTimesString() string {
+	var buf bytes.Buffer
+	for i, d := range p.PhaseTimes {
+		if d > 0 {
+			fmt.Fprintf(&buf, "\t-Phase %d:\t%s\n", i+1, d)
+		}
+	}
+	if p.TotalTime > 0 {
+		fmt.Fprintf(&buf, "\t-Total:\t%s\n", p.TotalTime)
+	}
+	if p.CopyTime > 0 {
+		fmt.Fprintf(&buf, "\t-Copy:\t%s\n", p.CopyTime)
+	}
+	return buf.String()
+}
+
+//ParseLine updates the progress from a single line of the plotter output
+func (p *PlotProgress) ParseLine(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.parser.ParseLine(p, strings.TrimRight(line, "\r"))
+}
+
+//setPhase moves the progress to a new phase
+func (p *PlotProgress) setPhase(phase int) {
+	p.Phase = phase
+	p.PhaseStart = time.Now()
+	p.Table = 0
+	p.Bucket = 0
+}
+
+//setPercent sets the percentage done within the current phase given the step, the number of steps and the
+// fraction done within that step
+func (p *PlotProgress) setPercent(step, steps int, stepFraction float64) {
+	if p.Phase < 1 || p.Phase > 4 {
+		return
+	}
+	var base float64
+	for i := 0; i < p.Phase-1; i++ {
+		base += phaseSpans[i]
+	}
+	span := phaseSpans[p.Phase-1]
+	pct := base + span*(float64(step)+stepFraction)/float64(steps)
+	if pct > p.Percent {
+		p.Percent = pct
+	}
+}
+
+//bucketFraction returns the fraction of buckets done for the current step
+func (p *PlotProgress) bucketFraction() float64 {
+	if p.Buckets <= 0 {
+		return 0
+	}
+	f := float64(p.Bucket) / float64(p.Buckets)
+	if f > 1 {
+		return 1
+	}
+	return f
+}
+
+//parseSeconds parses a float64 string of seconds to a time.Duration
+func parseSeconds(s string) time.Duration {
+	secs, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(secs * float64(time.Second)).Truncate(time.Second)
+}
+
+//newLineWriter creates a new lineWriter that calls fn for every complete line
+func newLineWriter(fn func(line string)) *lineWriter {
+	return &lineWriter{
+		fn: fn,
+		mu: &sync.Mutex{},
+	}
+}
+
+//lineWriter is an io.Writer that splits everything written to it into lines
+type lineWriter struct {
+	buf []byte
+	fn  func(line string)
+	mu  *sync.Mutex
+}
+
+//Write implements io.Writer
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, b...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.fn(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+//newPlotTracker creates a new PlotTracker
+func newPlotTracker() *PlotTracker {
+	return &PlotTracker{
+		plots: map[int]*PlotProgress{},
+		mu:    &sync.RWMutex{},
+	}
+}
+
+//PlotTracker keeps the progress records of all active plot processes by PID
+type PlotTracker struct {
+	plots map[int]*PlotProgress
+	mu    *sync.RWMutex
+}
+
+//Add adds the given progress record with the given PID
+func (t *PlotTracker) Add(pid int, p *PlotProgress) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p.SetPID(pid)
+	t.plots[pid] = p
+}
+
+//Get returns the progress record for the given PID
+func (t *PlotTracker) Get(pid int) (*PlotProgress, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	p, ok := t.plots[pid]
+	return p, ok
+}
+
+//Remove removes the progress record for the given PID and returns it
+func (t *PlotTracker) Remove(pid int) *PlotProgress {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p := t.plots[pid]
+	delete(t.plots, pid)
+	return p
+}
+
+//All returns snapshots of all progress records sorted by PID
+func (t *PlotTracker) All() []PlotProgress {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make([]PlotProgress, 0, len(t.plots))
+	for _, p := range t.plots {
+		out = append(out, p.Snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].PID < out[j].PID
+	})
+	return out
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPlotProgress(t *testing.T) {
+	tests := []struct {
+		plotter    Plotter
+		file       string
+		plotID     string
+		phaseTimes [4]time.Duration
+		totalTime  time.Duration
+		copyTime   time.Duration
+	}{
+		{
+			plotter:    chiaPlotter{},
+			file:       "testdata/chia_plots_create.log",
+			plotID:     "3f5a1e0e2d5c9b0fbd6b0b4b3f9c8b2c6a3d8e1f0a9b7c6d5e4f3a2b1c0d9e8f",
+			phaseTimes: [4]time.Duration{8000 * time.Second, 3000 * time.Second, 6000 * time.Second, 500 * time.Second},
+			totalTime:  17500 * time.Second,
+			copyTime:   600 * time.Second,
+		},
+		{
+			plotter:    madmaxPlotter{},
+			file:       "testdata/madmax_chia_plot.log",
+			plotID:     "8c4f6d1e2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5",
+			phaseTimes: [4]time.Duration{1374 * time.Second, 540 * time.Second, 1020 * time.Second, 90 * time.Second},
+			totalTime:  3025 * time.Second,
+			copyTime:   412 * time.Second,
+		},
+		{
+			plotter:    bladebitPlotter{},
+			file:       "testdata/bladebit.log",
+			plotID:     "8c4f6d1e2a3b4c5d6e7f8091a2b3c4d5e6f708192a3b4c5d6e7f8091a2b3c4d5",
+			phaseTimes: [4]time.Duration{243 * time.Second, 30 * time.Second, 190 * time.Second, 6 * time.Second},
+			totalTime:  590 * time.Second,
+			copyTime:   120 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		b, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := newPlotProgress(tt.plotter)
+		w := newLineWriter(p.ParseLine)
+
+		var last float64
+		for _, c := range b {
+			// write byte by byte to make sure partial lines are handled
+			if _, err = w.Write([]byte{c}); err != nil {
+				t.Fatal(err)
+			}
+			s := p.Snapshot()
+			if s.Percent < last {
+				t.Fatalf("%s: percent went backwards from %.2f to %.2f in phase %d",
+					tt.plotter.Name(), last, s.Percent, s.Phase)
+			}
+			last = s.Percent
+		}
+
+		s := p.Snapshot()
+		if s.Phase != PhaseDone {
+			t.Errorf("%s: expected phase %d, got %d", tt.plotter.Name(), PhaseDone, s.Phase)
+		}
+		if s.Percent != 100 {
+			t.Errorf("%s: expected 100%%, got %.2f", tt.plotter.Name(), s.Percent)
+		}
+		if s.PlotID != tt.plotID {
+			t.Errorf("%s: expected plot id %s, got %s", tt.plotter.Name(), tt.plotID, s.PlotID)
+		}
+		if s.PhaseTimes != tt.phaseTimes {
+			t.Errorf("%s: expected phase times %v, got %v", tt.plotter.Name(), tt.phaseTimes, s.PhaseTimes)
+		}
+		if s.TotalTime != tt.totalTime {
+			t.Errorf("%s: expected total time %s, got %s", tt.plotter.Name(), tt.totalTime, s.TotalTime)
+		}
+		if s.CopyTime != tt.copyTime {
+			t.Errorf("%s: expected copy time %s, got %s", tt.plotter.Name(), tt.copyTime, s.CopyTime)
+		}
+	}
+}
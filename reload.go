@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+//keepRestartSettings copies the settings that only take effect on restart from prev to next
+// and returns the names of those that were changed
+func keepRestartSettings(prev, next *envVars) []string {
+	var changed []string
+	if next.StateFile != prev.StateFile {
+		changed = append(changed, "StateFile")
+		next.StateFile = prev.StateFile
+	}
+	if next.HistoryFile != prev.HistoryFile {
+		changed = append(changed, "HistoryFile")
+		next.HistoryFile = prev.HistoryFile
+	}
+	if next.StagingDir != prev.StagingDir {
+		changed = append(changed, "StagingDir")
+		next.StagingDir = prev.StagingDir
+	}
+	if next.HTTPListen != prev.HTTPListen {
+		changed = append(changed, "HTTPListen")
+		next.HTTPListen = prev.HTTPListen
+	}
+	if next.CPUPinning != prev.CPUPinning {
+		changed = append(changed, "CPUPinning")
+		next.CPUPinning = prev.CPUPinning
+	}
+	if next.ReservedCores != prev.ReservedCores {
+		changed = append(changed, "ReservedCores")
+		next.ReservedCores = prev.ReservedCores
+	}
+	return changed
+}
+
+//syncDirs adds the plot and farm dirs discovered from the given env that are not in the pools yet and drains
+// the dirs that are no longer configured or found
+// dirs that can not be accessed anymore are removed right away
+// the dir selection strategies of the pools are updated too
+func (r *Runner) syncDirs(e *envVars) {
+	r.PlotPool.SetStrategy(e.PlotDirStrategy)
+	r.FarmPool.SetStrategy(e.FarmDirStrategy)
+
+	farmDirs := map[string]bool{}
+	for _, d := range discoverFarmDirs(e) {
+		farmDirs[d] = true
+		if fd := r.FarmPool.Find(d); fd != nil {
+			if fd.Draining() {
+				fd.SetDraining(false)
+				logF("farm directory %s is configured again, no longer draining\n", d)
+			}
+			continue
+		}
+		r.FarmPool.AddDirs(NewFarmDir(d))
+		logF("added farm directory %s\n", d)
+	}
+	for _, fd := range r.FarmPool.Dirs() {
+		if farmDirs[fd.dirStr] {
+			continue
+		}
+		if _, err := statFS(fd.dirStr); err != nil {
+			// the drive is gone, plots still using it fail on their own
+			r.FarmPool.Remove(fd.dirStr)
+			logErrF("farm directory %s is gone, removed it: %v\n", fd.dirStr, err)
+			continue
+		}
+		if !fd.Draining() {
+			fd.SetDraining(true)
+			logF("farm directory %s is no longer configured, draining %d running plots\n", fd.dirStr, len(fd.PIDs()))
+		}
+	}
+
+	plotDirs := map[string]bool{}
+	for _, d := range discoverPlotDirs(e) {
+		plotDirs[d] = true
+		if pd := r.PlotPool.Find(d); pd != nil {
+			if pd.Draining() {
+				pd.SetDraining(false)
+				logF("plot directory %s is configured again, no longer draining\n", d)
+			}
+			if plotter := plotterFor(d); plotter.Name() != pd.Plotter().Name() || pd.PlotterPending() {
+				if pd.SetPlotter(plotter) {
+					logF("plot directory %s now uses plotter %s\n", d, plotter.Name())
+				} else {
+					logF("plotter of plot directory %s was changed to %s, it gets no new plots until its %d running plots are done\n",
+						d, plotter.Name(), len(pd.PIDs()))
+				}
+			}
+			continue
+		}
+		pd := newPlotDir(d, plotterFor(d))
+		r.PlotPool.AddDirs(pd)
+		logF("added plot directory %s using plotter %s\n", d, pd.Plotter().Name())
+	}
+	for _, pd := range r.PlotPool.Dirs() {
+		if plotDirs[pd.dirStr] {
+			continue
+		}
+		if _, err := statFS(pd.dirStr); err != nil {
+			r.PlotPool.Remove(pd.dirStr)
+			logErrF("plot directory %s is gone, removed it: %v\n", pd.dirStr, err)
+			continue
+		}
+		if !pd.Draining() {
+			pd.SetDraining(true)
+			logF("plot directory %s is no longer configured, draining %d running plots\n", pd.dirStr, len(pd.PIDs()))
+		}
+	}
+
+	r.pruneDirs()
+}
+
+//pruneDirs removes the draining dirs without running plots from the pools
+func (r *Runner) pruneDirs() {
+	for _, fd := range r.FarmPool.Dirs() {
+		if fd.Draining() && len(fd.PIDs()) == 0 {
+			r.FarmPool.Remove(fd.dirStr)
+			logF("removed farm directory %s\n", fd.dirStr)
+		}
+	}
+	for _, pd := range r.PlotPool.Dirs() {
+		if pd.Draining() && len(pd.PIDs()) == 0 {
+			r.PlotPool.Remove(pd.dirStr)
+			logF("removed plot directory %s\n", pd.dirStr)
+		}
+	}
+}
+
+//Reload re-reads the config and applies it to the runner
+// new dirs are added, removed dirs are drained and all other settings are replaced at once
+// if the config is invalid, the running config is kept
+func (r *Runner) Reload() error {
+	next, err := readEnv(getEnv())
+	if err != nil {
+		return fmt.Errorf("invalid config, keeping the running config: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range keepRestartSettings(getEnv(), next) {
+		logErrF("%s was changed, the change takes effect on restart\n", name)
+	}
+	setEnv(next)
+	r.syncDirs(next)
+	logF("config reloaded, max parallel plots: %d\n", next.MaxParallelPlots)
+	return nil
+}
+
+//watchConfig reloads the config whenever the modification time of the config file changes
+func (r *Runner) watchConfig(ctx context.Context, path string, interval time.Duration) {
+	var modTime time.Time
+	if fi, err := os.Stat(path); err == nil {
+		modTime = fi.ModTime()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil || fi.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = fi.ModTime()
+		logF("config file %s changed, reloading...\n", path)
+		if err = r.Reload(); err != nil {
+			logErrLn(err)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+//testConfig creates the dirs and chia activate script a test config refers to in the given dir
+// and returns the config header setting ChiaDir, StateFile and AllowSameFilesystem
+func testConfig(t *testing.T, tmp string, dirs ...string) string {
+	for _, d := range dirs {
+		if err := os.MkdirAll(filepath.Join(tmp, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "activate"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fmt.Sprintf("ChiaDir = %q\nStateFile = %q\nAllowSameFilesystem = true\nPlotter = \"bladebit\"\n",
+		tmp, filepath.Join(tmp, "state.json"))
+}
+
+func TestReload(t *testing.T) {
+	tmp := t.TempDir()
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	prevConfigFile := flagConfigFile
+	defer func() { flagConfigFile = prevConfigFile }()
+	flagConfigFile = filepath.Join(tmp, "config.toml")
+
+	header := testConfig(t, tmp, "a", "b", "c", "d", "e")
+	dir := func(d string) string {
+		return filepath.Join(tmp, d)
+	}
+	writeConfig := func(config string, v ...interface{}) {
+		if err := os.WriteFile(flagConfigFile, []byte(header+fmt.Sprintf(config, v...)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("MaxParallelPlots = 2\nPlotDirs = [%q, %q]\nFarmDirs = [%q]\n", dir("a"), dir("b"), dir("c"))
+	e, err := readEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setEnv(e)
+	r := newRunner()
+	r.syncDirs(e)
+	r.PlotPool.Find(dir("a")).AddPID(1)
+
+	writeConfig("MaxParallelPlots = 5\nPlotDirs = [%q, %q]\nFarmDirs = [%q, %q]\n",
+		dir("b"), dir("d"), dir("c"), dir("e"))
+	header += "HTTPListen = \"127.0.0.1:8555\"\n"
+	if err = r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if getEnv().MaxParallelPlots != 5 {
+		t.Errorf("expected max parallel plots 5, got %d", getEnv().MaxParallelPlots)
+	}
+	if pd := r.PlotPool.Find(dir("a")); pd == nil || !pd.Draining() {
+		t.Errorf("expected removed plot dir with a running plot to be draining")
+	}
+	if pd := r.PlotPool.Find(dir("d")); pd == nil || pd.Draining() {
+		t.Errorf("expected new plot dir to be added")
+	}
+	if r.FarmPool.Find(dir("e")) == nil || r.FarmPool.DirCnt() != 2 {
+		t.Errorf("expected new farm dir to be added")
+	}
+
+	writeConfig("MaxParallelPlots = 5\nPlotDirs = [%q]\nFarmDirs = [%q]\n", dir("b"), dir("c"))
+	if err = r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if len(getEnv().HTTPListen) > 0 {
+		t.Errorf("expected HTTPListen to be kept until restart, got %s", getEnv().HTTPListen)
+	}
+
+	writeConfig("Plotter = \"unknown\"\n")
+	if err = r.Reload(); err == nil {
+		t.Errorf("expected invalid config to be rejected")
+	}
+	if getEnv().MaxParallelPlots != 5 || r.PlotPool.DirCnt() != 2 {
+		t.Errorf("expected running config to be kept after an invalid reload")
+	}
+
+	r.PlotPool.Find(dir("a")).RmPID(1)
+	r.pruneDirs()
+	if r.PlotPool.Find(dir("a")) != nil || r.PlotPool.DirCnt() != 1 {
+		t.Errorf("expected drained plot dir to be removed, got %d dirs", r.PlotPool.DirCnt())
+	}
+}
+
+func TestSyncDirsPlotter(t *testing.T) {
+	tmp := t.TempDir()
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	prevConfigFile := flagConfigFile
+	defer func() { flagConfigFile = prevConfigFile }()
+	flagConfigFile = filepath.Join(tmp, "config.toml")
+
+	dir := func(d string) string {
+		return filepath.Join(tmp, d)
+	}
+	config := testConfig(t, tmp, "a", "b", "c") +
+		fmt.Sprintf("MaxParallelPlots = 2\nPlotDirs = [%q, %q]\nFarmDirs = [%q]\n", dir("a"), dir("b"), dir("c"))
+	if err := os.WriteFile(flagConfigFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	e, err := readEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setEnv(e)
+	r := newRunner()
+	r.syncDirs(e)
+	r.PlotPool.Find(dir("a")).AddPID(1)
+
+	// the plotter of a dir is replaced once it has no running plots, it gets no new plots until then
+	next := *e
+	next.Plotter = PlotterMadmax
+	setEnv(&next)
+	r.syncDirs(&next)
+	if p := r.PlotPool.Find(dir("a")).Plotter().Name(); p != PlotterBladebit {
+		t.Errorf("expected the dir with a running plot to keep its plotter, got %s", p)
+	}
+	if p := r.PlotPool.Find(dir("b")).Plotter().Name(); p != PlotterMadmax {
+		t.Errorf("expected the idle dir to use the new plotter, got %s", p)
+	}
+	stats := fakeStats{dir("a"): ByteSzFromGiB(10240), dir("b"): ByteSzFromGiB(10240)}
+	for _, pd := range r.PlotPool.Dirs() {
+		pd.stat = stats.stat
+	}
+	for i := 0; i < 3; i++ {
+		if pd, err := r.PlotPool.NextUp(nil); err != nil || pd.dirStr != dir("b") {
+			t.Errorf("expected only the idle dir to get new plots, got %v %v", pd, err)
+		}
+	}
+
+	r.PlotPool.Find(dir("a")).RmPID(1)
+	if p := r.PlotPool.Find(dir("a")).Plotter().Name(); p != PlotterMadmax {
+		t.Errorf("expected the dir to use the new plotter once its plot is done, got %s", p)
+	}
+	if pd, err := r.PlotPool.NextUp(nil); err != nil || pd.dirStr != dir("a") {
+		t.Errorf("expected the dir to get new plots again, got %v %v", pd, err)
+	}
+}
+
+func TestReloadOfflineDir(t *testing.T) {
+	tmp := t.TempDir()
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	prevConfigFile := flagConfigFile
+	defer func() { flagConfigFile = prevConfigFile }()
+	flagConfigFile = filepath.Join(tmp, "config.toml")
+
+	dir := func(d string) string {
+		return filepath.Join(tmp, d)
+	}
+	header := testConfig(t, tmp, "a", "usb1", "usb2")
+	writeConfig := func(farmDirs ...string) {
+		config := fmt.Sprintf("MaxParallelPlots = 2\nPlotDirs = [%q]\nFarmDirs = [\"%s\"]\n", dir("a"),
+			strings.Join(farmDirs, `", "`))
+		if err := os.WriteFile(flagConfigFile, []byte(header+config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig(dir("usb1"), dir("usb2"))
+	e, err := readEnv(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setEnv(e)
+	r := newRunner()
+	r.syncDirs(e)
+
+	// a drive of a farm dir in use is gone, the dir is kept for the health checks to mark it offline
+	if err = os.Remove(dir("usb2")); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Reload(); err != nil {
+		t.Fatalf("expected the reload to keep the offline farm dir, got %v", err)
+	}
+	fd := r.FarmPool.Find(dir("usb2"))
+	if fd == nil {
+		t.Fatal("expected the offline farm dir to be kept")
+	}
+	fd.CheckHealth()
+	if h, _ := fd.Health(); h != HealthOffline {
+		t.Errorf("expected the farm dir to be offline, got %s", h)
+	}
+
+	// a new dir that can not be reached is still a config error
+	writeConfig(dir("usb1"), dir("usb2"), dir("usb3"))
+	if err = r.Reload(); err == nil || !strings.Contains(err.Error(), "farm dir "+dir("usb3")) {
+		t.Errorf("expected the unreachable new farm dir to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PlotTypeSolo = "solo"
+	PlotTypePool = "pool"
+
+	// the memo of a plot holds the pool public key or the pool contract puzzle hash, the farmer public key and
+	// the local master secret key
+	soloMemoSize = 48 + 48 + 32
+	poolMemoSize = 32 + 48 + 32
+)
+
+var plotMagic = []byte("Proof of Space Plot")
+
+//replotConfig selects the farmed plots that may be deleted to make room for new plots
+// a plot is replaceable if it matches all the rules that are set
+type replotConfig struct {
+	// Enabled turns on the replot mode
+	Enabled bool
+	// PlotType is solo for plots with a pool public key or pool for plots with a pool contract, empty for both
+	PlotType string
+	// KSizes are the k sizes of replaceable plots, empty for all
+	KSizes []int
+	// MinAgeDays is the min age in days of replaceable plots
+	MinAgeDays int
+	// Patterns are glob patterns of the file names of replaceable plots, empty for all
+	Patterns []string
+	// MinFarmedPlots is the number of plots in the farm dirs that replotting never goes below
+	MinFarmedPlots int
+}
+
+//check adds the problems of the config to errs
+func (c replotConfig) check(errs *configErrors) {
+	if !c.Enabled {
+		return
+	}
+	if c.PlotType != "" && c.PlotType != PlotTypeSolo && c.PlotType != PlotTypePool {
+		errs.add("invalid Replot.PlotType %q, must be solo or pool", c.PlotType)
+	}
+	// without any rule the new plots would replace each other
+	if len(c.PlotType) == 0 && len(c.KSizes) == 0 && c.MinAgeDays <= 0 && len(c.Patterns) == 0 {
+		errs.add("Replot is enabled without PlotType, KSizes, MinAgeDays or Patterns")
+	}
+	for _, p := range c.Patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			errs.add("invalid Replot pattern %q: %v", p, err)
+		}
+	}
+	if c.MinFarmedPlots < 0 {
+		errs.add("invalid Replot.MinFarmedPlots %d", c.MinFarmedPlots)
+	}
+}
+
+//plotHeader is the part of the header of a plot file that tells which plots are replaceable
+type plotHeader struct {
+	ID   string
+	K    int
+	Type string
+}
+
+//readPlotHeader reads the header of the plot file
+func readPlotHeader(file string) (plotHeader, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return plotHeader{}, err
+	}
+	defer f.Close()
+	return parsePlotHeader(f)
+}
+
+//parsePlotHeader parses the header of a plot: the magic, the plot ID, k, the format description and the memo
+func parsePlotHeader(r io.Reader) (plotHeader, error) {
+	var h plotHeader
+	buf := make([]byte, len(plotMagic)+32+1)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return h, err
+	}
+	if !bytes.Equal(buf[:len(plotMagic)], plotMagic) {
+		return h, fmt.Errorf("not a plot file")
+	}
+	h.ID = hex.EncodeToString(buf[len(plotMagic) : len(plotMagic)+32])
+	h.K = int(buf[len(buf)-1])
+
+	var n uint16
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return h, err
+	}
+	if _, err := io.CopyN(io.Discard, r, int64(n)); err != nil {
+		return h, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return h, err
+	}
+	switch n {
+	case soloMemoSize:
+		h.Type = PlotTypeSolo
+	case poolMemoSize:
+		h.Type = PlotTypePool
+	default:
+		return h, fmt.Errorf("unknown plot memo size %d", n)
+	}
+	return h, nil
+}
+
+//farmedPlot is a plot file in a farm dir
+type farmedPlot struct {
+	Path    string
+	Dir     string
+	Size    ByteSz
+	ModTime time.Time
+	Header  plotHeader
+}
+
+//Replaceable returns true if the plot matches all rules of the config
+func (c replotConfig) Replaceable(p farmedPlot, now time.Time) bool {
+	if len(c.PlotType) > 0 && p.Header.Type != c.PlotType {
+		return false
+	}
+	if len(c.KSizes) > 0 {
+		found := false
+		for _, k := range c.KSizes {
+			found = found || k == p.Header.K
+		}
+		if !found {
+			return false
+		}
+	}
+	if c.MinAgeDays > 0 && now.Sub(p.ModTime) < time.Duration(c.MinAgeDays)*24*time.Hour {
+		return false
+	}
+	if len(c.Patterns) > 0 {
+		for _, pattern := range c.Patterns {
+			if ok, _ := filepath.Match(pattern, filepath.Base(p.Path)); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+//checkNewPlots adds a problem if the rules match new k32 plots of the given types, apart from their age
+// they would replace each other until only MinFarmedPlots are left
+func (c replotConfig) checkNewPlots(types []string, errs *configErrors) {
+	if !c.Enabled {
+		return
+	}
+	c.MinAgeDays = 0
+	now := time.Now()
+	name := fmt.Sprintf("plot-k32-%s-%s.plot", now.Format("2006-01-02-15-04"), strings.Repeat("0", 64))
+	for _, t := range types {
+		p := farmedPlot{Path: name, ModTime: now, Header: plotHeader{K: 32, Type: t}}
+		if c.Replaceable(p, now) {
+			errs.add("Replot rules match the new %s plots, set PlotType, KSizes or Patterns so they exclude them", t)
+		}
+	}
+}
+
+//newReplotter creates a new replotter
+func newReplotter() *replotter {
+	return &replotter{
+		headers: map[string]plotHeader{},
+		mu:      &sync.Mutex{},
+	}
+}
+
+//replotter deletes replaceable plots from the farm dirs right before new plots need their space
+type replotter struct {
+	// headers caches the headers of the farmed plots, they never change
+	headers map[string]plotHeader
+	mu      *sync.Mutex
+}
+
+//farmedPlots returns the plots in the dirs, oldest first
+// the caller must hold the replotter lock
+func (rp *replotter) farmedPlots(dirs []*FarmDir) []farmedPlot {
+	var plots []farmedPlot
+	seen := map[string]bool{}
+	for _, fd := range dirs {
+		files, err := filepath.Glob(filepath.Join(fd.dirStr, "*.plot"))
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			fi, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			h, ok := rp.headers[file]
+			if !ok {
+				if h, err = readPlotHeader(file); err != nil {
+					// plots that can not be read are left alone
+					h = plotHeader{}
+				}
+				rp.headers[file] = h
+			}
+			seen[file] = true
+			plots = append(plots, farmedPlot{Path: file, Dir: fd.dirStr, Size: ByteSz(fi.Size()),
+				ModTime: fi.ModTime(), Header: h})
+		}
+	}
+	for file := range rp.headers {
+		if !seen[file] {
+			delete(rp.headers, file)
+		}
+	}
+	sort.SliceStable(plots, func(i, j int) bool {
+		return plots[i].ModTime.Before(plots[j].ModTime)
+	})
+	return plots
+}
+
+//replaceable returns the replaceable plots of the farmed plots, oldest first
+func replaceable(c replotConfig, plots []farmedPlot) []farmedPlot {
+	now := time.Now()
+	var out []farmedPlot
+	for _, p := range plots {
+		if len(p.Header.Type) > 0 && c.Replaceable(p, now) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+//Refresh updates the space of the replaceable plots of the farm dirs that is counted as available for new plots
+func (rp *replotter) Refresh(dirs []*FarmDir) {
+	c := getEnv().Replot
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	rp.refresh(c, dirs)
+}
+
+//refresh updates the replaceable space of the farm dirs
+// the caller must hold the replotter lock
+func (rp *replotter) refresh(c replotConfig, dirs []*FarmDir) {
+	space := map[string]ByteSz{}
+	if c.Enabled {
+		// the oldest plots are counted up to the number of plots that can go without going below the min
+		plots := rp.farmedPlots(dirs)
+		budget := len(plots) - c.MinFarmedPlots
+		for i, p := range replaceable(c, plots) {
+			if i >= budget {
+				break
+			}
+			space[p.Dir] = space[p.Dir].Add(p.Size)
+		}
+	}
+	for _, fd := range dirs {
+		fd.setReplaceable(space[fd.dirStr])
+	}
+}
+
+//MakeRoom deletes the oldest replaceable plots of the farm dir until it has the given space available
+// dirs are all farm dirs, which the min number of farmed plots applies to
+func (rp *replotter) MakeRoom(fd *FarmDir, need ByteSz, dirs []*FarmDir) error {
+	env := getEnv()
+	if !env.Replot.Enabled {
+		return nil
+	}
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+	need = need.Add(env.FarmDirReserve(fd.dirStr))
+	avail := fd.DiskStat().Available
+	if avail >= need {
+		return nil
+	}
+	defer rp.refresh(env.Replot, dirs)
+	plots := rp.farmedPlots(dirs)
+	farmed := len(plots)
+	for _, p := range replaceable(env.Replot, plots) {
+		if avail >= need || farmed <= env.Replot.MinFarmedPlots {
+			break
+		}
+		if p.Dir != fd.dirStr {
+			continue
+		}
+		if err := os.Remove(p.Path); err != nil {
+			return fmt.Errorf("could not delete plot %s: %w", p.Path, err)
+		}
+		avail = avail.Add(p.Size)
+		farmed--
+		metrics.PlotsReplaced.Inc(fd.dirStr)
+		logF("deleted plot %s (%s, k%d, %s) to make room for a new plot\n",
+			p.Path, p.Header.Type, p.Header.K, p.ModTime.Format("2006-01-02"))
+	}
+	if avail < need {
+		return fmt.Errorf("%s available in %s after deleting the replaceable plots, %s needed", avail, fd.dirStr, need)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//plotFileHeader returns the header of a plot file with the given k and memo size
+func plotFileHeader(k, memoSize int) []byte {
+	var buf bytes.Buffer
+	buf.Write(plotMagic)
+	buf.Write(bytes.Repeat([]byte{0xab}, 32))
+	buf.WriteByte(byte(k))
+	format := "v1.0"
+	binary.Write(&buf, binary.BigEndian, uint16(len(format)))
+	buf.WriteString(format)
+	binary.Write(&buf, binary.BigEndian, uint16(memoSize))
+	buf.Write(make([]byte, memoSize))
+	return buf.Bytes()
+}
+
+func TestParsePlotHeader(t *testing.T) {
+	for _, tt := range []struct {
+		k, memo int
+		typ     string
+	}{
+		{32, soloMemoSize, PlotTypeSolo},
+		{33, poolMemoSize, PlotTypePool},
+	} {
+		h, err := parsePlotHeader(bytes.NewReader(plotFileHeader(tt.k, tt.memo)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.K != tt.k || h.Type != tt.typ || h.ID != string(bytes.Repeat([]byte("ab"), 32)) {
+			t.Errorf("expected a k%d %s plot, got %+v", tt.k, tt.typ, h)
+		}
+	}
+	if _, err := parsePlotHeader(bytes.NewReader([]byte("not a plot at all, not a plot at all, not a plot"))); err == nil {
+		t.Error("expected an error for a file that is not a plot")
+	}
+}
+
+func TestReplot(t *testing.T) {
+	tmp := t.TempDir()
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{Replot: replotConfig{Enabled: true, PlotType: PlotTypeSolo, KSizes: []int{32}, MinFarmedPlots: 3}})
+
+	farm1, farm2 := filepath.Join(tmp, "farm1"), filepath.Join(tmp, "farm2")
+	stats := fakeStats{farm1: 0, farm2: 0}
+	var dirs []*FarmDir
+	for _, d := range []string{farm1, farm2} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+		fd := NewFarmDir(d)
+		fd.stat = stats.stat
+		dirs = append(dirs, fd)
+	}
+
+	old := time.Now().Add(-72 * time.Hour)
+	plots := []struct {
+		dir, name string
+		k, memo   int
+	}{
+		{farm1, "plot-k32-solo-1.plot", 32, soloMemoSize},
+		{farm1, "plot-k32-solo-2.plot", 32, soloMemoSize},
+		{farm1, "plot-k32-pool-3.plot", 32, poolMemoSize},
+		{farm1, "plot-k33-solo-4.plot", 33, soloMemoSize},
+		{farm2, "plot-k32-solo-5.plot", 32, soloMemoSize},
+	}
+	for i, p := range plots {
+		f := filepath.Join(p.dir, p.name)
+		if err := os.WriteFile(f, plotFileHeader(p.k, p.memo), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := old.Add(time.Duration(i) * time.Hour)
+		if err := os.Chtimes(f, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	size := ByteSz(len(plotFileHeader(32, soloMemoSize)))
+
+	// 2 of the 5 plots may go, the 2 oldest solo k32 plots are both in farm1
+	rp := newReplotter()
+	rp.Refresh(dirs)
+	if r := dirs[0].Replaceable(); r != size*2 {
+		t.Errorf("expected %s replaceable in farm1, got %s", size*2, r)
+	}
+	if r := dirs[1].Replaceable(); r != 0 {
+		t.Errorf("expected nothing replaceable in farm2, got %s", r)
+	}
+
+	// only as many plots as needed are deleted
+	if err := rp.MakeRoom(dirs[0], size, dirs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(farm1, "plot-k32-solo-1.plot")); !os.IsNotExist(err) {
+		t.Error("expected the oldest replaceable plot to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(farm1, "plot-k32-solo-2.plot")); err != nil {
+		t.Errorf("expected the second replaceable plot to be kept: %v", err)
+	}
+
+	// the min number of farmed plots is never gone below
+	if err := rp.MakeRoom(dirs[1], size*2, dirs); err == nil {
+		t.Error("expected an error with no replaceable plots left to delete")
+	}
+	if _, err := os.Stat(filepath.Join(farm2, "plot-k32-solo-5.plot")); !os.IsNotExist(err) {
+		t.Error("expected the replaceable plot of farm2 to be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(farm1, "plot-k32-solo-2.plot")); err != nil {
+		t.Errorf("expected the plot to be kept with 3 plots left: %v", err)
+	}
+	if r := dirs[0].Replaceable(); r != 0 {
+		t.Errorf("expected nothing replaceable with 3 plots left, got %s", r)
+	}
+}
+
+func TestReplotCheckNewPlots(t *testing.T) {
+	tests := []struct {
+		replot replotConfig
+		types  []string
+		expect bool
+	}{
+		{replotConfig{Enabled: true, KSizes: []int{32}}, []string{PlotTypeSolo}, true},
+		{replotConfig{Enabled: true, MinAgeDays: 30}, []string{PlotTypeSolo}, true},
+		{replotConfig{Enabled: true, Patterns: []string{"plot-k32-*"}}, []string{PlotTypeSolo}, true},
+		{replotConfig{Enabled: true, PlotType: PlotTypeSolo}, []string{PlotTypeSolo}, true},
+		{replotConfig{Enabled: true, PlotType: PlotTypeSolo}, []string{PlotTypePool}, false},
+		{replotConfig{Enabled: true, PlotType: PlotTypeSolo}, []string{PlotTypePool, PlotTypeSolo}, true},
+		{replotConfig{Enabled: true, KSizes: []int{32}, Patterns: []string{"plot-k32-2021-*"}}, []string{PlotTypeSolo}, false},
+		{replotConfig{Enabled: true, KSizes: []int{25}}, []string{PlotTypeSolo}, false},
+		{replotConfig{KSizes: []int{32}}, []string{PlotTypeSolo}, false},
+	}
+	for _, tt := range tests {
+		var errs configErrors
+		tt.replot.checkNewPlots(tt.types, &errs)
+		if got := len(errs) > 0; got != tt.expect {
+			t.Errorf("%+v %v: expected the new plots to be matched %v, got %v", tt.replot, tt.types, tt.expect, errs)
+		}
+	}
+}
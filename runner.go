@@ -3,10 +3,12 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -15,12 +17,20 @@ var (
 	FarmPlotSpace = ByteSzFromGiB(101.4 + .2)
 
 	ErrMaxProcessesReached = fmt.Errorf("max processes reached")
+	ErrStaggered           = fmt.Errorf("plot start staggered")
+	ErrPaused              = fmt.Errorf("scheduling paused")
+	ErrNotEnoughMemory     = fmt.Errorf("not enough memory")
 )
 
 
 //newRunner creates a new Runner
 func newRunner() *Runner {
-	return &Runner{
+	env := getEnv()
+	daemonCPUs, plotCPUs, err := cpuSets(env.ReservedCores)
+	if err != nil && (env.CPUPinning || env.ReservedCores > 0) {
+		logFatalLn("could not get the available cpus:", err)
+	}
+	r := &Runner{
 		PlotPool: &PlotPool{
 			mu: &sync.RWMutex{},
 		},
@@ -28,8 +38,32 @@ func newRunner() *Runner {
 			mu: &sync.RWMutex{},
 		},
 		activeProcesses: map[int]*os.Process{},
+		Tracker:         newPlotTracker(),
+		states:          map[int]PlotState{},
+		store:           newStateStore(env.StateFile),
+		historyStore:    newHistoryStore(env.HistoryFile),
+		cpus:            newCPUAllocator(plotCPUs),
+		daemonCPUs:      daemonCPUs,
 		mu:              &sync.RWMutex{},
+		chiaMu:          &sync.Mutex{},
+		replot:          newReplotter(),
+	}
+	if len(env.StagingDir) > 0 {
+		r.staging = NewFarmDir(env.StagingDir)
+	}
+	r.mover = newMover(r.staging, r.FarmPool, r.replot, r.Tracker)
+	r.mover.onMoved = r.plotMoved
+	// the recently finished plots are kept in memory for the status
+	history, bad, err := r.historyStore.Load()
+	if err != nil {
+		logErrLn("could not load the plot history:", err)
+	} else if bad > 0 {
+		logErrF("skipped %d invalid records in the plot history %s\n", bad, env.HistoryFile)
+	}
+	for _, res := range history {
+		r.addHistory(res)
 	}
+	return r
 }
 
 //Runner maintains a PlotPool and FarmPool as well as a map of active processes
@@ -37,48 +71,301 @@ func newRunner() *Runner {
 type Runner struct {
 	PlotPool        *PlotPool
 	FarmPool        *FarmPool
+	staging         *FarmDir
+	mover           *mover
+	replot          *replotter
 	activeProcesses map[int]*os.Process
+	Tracker         *PlotTracker
+	states          map[int]PlotState
+	store           *stateStore
+	historyStore    *historyStore
+	cpus            *cpuAllocator
+	daemonCPUs      []int
+	lastStart       time.Time
+	paused          bool
+	draining        bool
+	diskLow         bool
+	refusal         string
+	history         []PlotResult
 	mu              *sync.RWMutex
-	//walletBalance
+	chiaStatus      ChiaStatus
+	chiaMu          *sync.Mutex
 }
 
 //MaxParallelPlots returns the maximum number of new plots
 func (r *Runner) MaxParallelPlots() int {
-	return env.MaxParallelPlots - len(r.activeProcesses)
+	return getEnv().MaxParallelPlots - len(r.activeProcesses)
+}
+
+//ActiveCnt returns the number of active plot processes
+func (r *Runner) ActiveCnt() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.activeProcesses)
+}
+
+//Pause stops scheduling new plots, running plots are left to finish
+func (r *Runner) Pause() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = true
+	logLn("scheduling paused")
+}
+
+//Drain stops scheduling new plots and makes the runner exit once all running plots have finished
+func (r *Runner) Drain() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = true
+	r.draining = true
+	logF("draining: waiting for %d running plots to finish\n", len(r.activeProcesses))
+}
+
+//Resume resumes scheduling new plots after a Pause or Drain
+func (r *Runner) Resume() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = false
+	r.draining = false
+	logLn("scheduling resumed")
+}
+
+//Paused returns true if scheduling new plots is paused
+func (r *Runner) Paused() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.paused
+}
+
+//Draining returns true if the runner exits once all running plots have finished
+func (r *Runner) Draining() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.draining
+}
+
+//earlyPlots returns the number of the given PIDs that have not left the given phase yet
+func (r *Runner) earlyPlots(pids []int, phase int) int {
+	cnt := 0
+	for _, pid := range pids {
+		if p, ok := r.Tracker.Get(pid); ok && p.Snapshot().Phase <= phase {
+			cnt++
+		}
+	}
+	return cnt
+}
+
+//staggerCheck returns an ErrStaggered error if the stagger policy does not allow a new plot to start yet
+func (r *Runner) staggerCheck() error {
+	env := getEnv()
+	if gap := env.MinStartGap(); gap > 0 && !r.lastStart.IsZero() {
+		if since := time.Since(r.lastStart); since < gap {
+			return fmt.Errorf("%w: last plot started %s ago, min gap is %s",
+				ErrStaggered, since.Truncate(time.Second), gap)
+		}
+	}
+	if env.MaxPhase1Plots > 0 {
+		pids := make([]int, 0, len(r.activeProcesses))
+		for pid := range r.activeProcesses {
+			pids = append(pids, pid)
+		}
+		if n := r.earlyPlots(pids, 1); n >= env.MaxPhase1Plots {
+			return fmt.Errorf("%w: %d plots in phase 1, max is %d", ErrStaggered, n, env.MaxPhase1Plots)
+		}
+	}
+	return nil
+}
+
+//committedMemory returns the memory the active plots may use at their peak
+func (r *Runner) committedMemory() ByteSz {
+	var total ByteSz
+	for pid := range r.activeProcesses {
+		if plotter, err := newPlotter(r.states[pid].Plotter); err == nil {
+			total = total.Add(plotMemory(plotter, r.states[pid].MemMB))
+		}
+	}
+	return total
+}
+
+//memoryCheck returns an ErrNotEnoughMemory error if a new plot needing the given memory would exceed the max memory,
+// leave less than the memory headroom available on the system or if the system is already swapping
+func (r *Runner) memoryCheck(need ByteSz, mem *MemStats) error {
+	env := getEnv()
+	if env.MaxMemoryMB > 0 {
+		if committed := r.committedMemory(); committed.Add(need) > env.MaxMemory() {
+			return fmt.Errorf("%w: running plots use up to %s, another %s would exceed the max of %s",
+				ErrNotEnoughMemory, committed, need, env.MaxMemory())
+		}
+	}
+	if mem.Available.Sub(env.MemoryHeadroom()) < need {
+		return fmt.Errorf("%w: %s available, a new plot needs %s plus %s headroom",
+			ErrNotEnoughMemory, mem.Available, need, env.MemoryHeadroom())
+	}
+	if env.MaxSwapUsedMB > 0 && mem.SwapUsed > env.MaxSwapUsed() {
+		return fmt.Errorf("%w: %s swap in use, max is %s", ErrNotEnoughMemory, mem.SwapUsed, env.MaxSwapUsed())
+	}
+	return nil
+}
+
+//tempDirAccepts returns true if the given temp dir is below the max number of plots in phase 1 or 2 and the temp
+// dirs of a new plot have space for it once the space the running plots still need in them as second temp dir is
+// reserved
+func (r *Runner) tempDirAccepts(pd *PlotDir) bool {
+	env := getEnv()
+	plotter := pd.Plotter()
+	if reserved := r.secondTempReserved(pd.dirStr); reserved > 0 &&
+		pd.PlottingSpaceAvail().Sub(reserved) <= plotter.TempSpace() {
+		return false
+	}
+	if dir2 := env.PlotDirSettings(pd.dirStr).SecondTempDir; len(dir2) > 0 && plotter.TempSpace2() > 0 {
+		stat, err := statFS(dir2)
+		if err != nil {
+			logErrF("could not stat second temp dir %s: %v\n", dir2, err)
+			return false
+		}
+		avail := stat.Available.Sub(r.secondTempReserved(dir2))
+		if p := r.PlotPool.Find(dir2); p != nil {
+			avail = avail.Sub(p.Reserved())
+		}
+		if avail < plotter.TempSpace2() {
+			logF("second temp dir %s has %s available, a plot needs %s\n", dir2, avail, plotter.TempSpace2())
+			return false
+		}
+	}
+	if env.MaxTempDirEarlyPlots <= 0 {
+		return true
+	}
+	return r.earlyPlots(pd.PIDs(), 2) < env.MaxTempDirEarlyPlots
+}
+
+//secondTempReserved returns the space the running plots still need in the given dir as their second temp dir to
+// reach their peak footprint there, the temp files they have already written in it are deducted
+// the caller must hold the runner lock
+func (r *Runner) secondTempReserved(dir string) ByteSz {
+	var total ByteSz
+	for pid, st := range r.states {
+		if st.TempDir2 != dir {
+			continue
+		}
+		plotter, err := newPlotter(st.Plotter)
+		if err != nil {
+			continue
+		}
+		var plotID string
+		if p, ok := r.Tracker.Get(pid); ok {
+			plotID = p.Snapshot().PlotID
+		}
+		if written := filesSize(plotTempFiles(plotID, dir)); written < plotter.TempSpace2() {
+			total = total.Add(plotter.TempSpace2().Sub(written))
+		}
+	}
+	return total
 }
 
 // plot attempts to create a new plot by running the chia plots create command using the next available
 // plotting dir and farming dir
 // if no space is available or not enough memory or cpu resources are available, then this returns
 // an ErrMaxProcessesReached error
+// if the stagger policy does not allow a new plot yet, then this returns an ErrStaggered error
+// if starting the plot would exceed the memory limits, then this returns an ErrNotEnoughMemory error
+// if scheduling is paused, then this returns an ErrPaused error
+// the reason a plot was refused is kept for the status until the next plot is started
 // commands are executed and then waited on in a separate go routine
-func (r *Runner) plot() error {
+func (r *Runner) plot() (err error) {
+	env := getEnv()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() {
+		r.refusal = ""
+		if err != nil {
+			r.refusal = err.Error()
+		}
+	}()
+
 	if r.MaxParallelPlots() < 1 {
 		return ErrMaxProcessesReached
 	}
 
-	logLn("starting new plot process...")
+	if r.paused {
+		return ErrPaused
+	}
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := r.staggerCheck(); err != nil {
+		return err
+	}
 
-	plotDir, err := r.PlotPool.NextUp()
+	logLn("starting new plot process...")
+
+	plotDir, err := r.PlotPool.NextUp(r.tempDirAccepts)
 	if err != nil {
 		return err
 	}
 	logLn("plot dir", plotDir.dirStr, "has been selected with", plotDir.AvailableSpace(), "free space")
+	settings := env.PlotDirSettings(plotDir.dirStr)
+	plotter := plotDir.Plotter()
 
-	farmDir, err := r.FarmPool.NextUp()
+	mem, err := memStats()
 	if err != nil {
+		logErrLn("could not get memory stats:", err)
+	} else if err = r.memoryCheck(plotMemory(plotter, settings.MemMB), mem); err != nil {
 		return err
 	}
+
+	farmDir, err := r.nextFarmDir()
+	if err != nil {
+		if err == ErrMaxProcessesReached && !r.diskLow {
+			r.diskLow = true
+			Notify(EventDiskLow, 0, "no farm space available",
+				fmt.Sprintf("none of the farm dirs have space for another plot\n\nCURRENT STATUS:\n\n%s", r.StatusString()))
+		}
+		return err
+	}
+	r.diskLow = false
 	logLn("farm dir", farmDir.dirStr, "has been selected with", farmDir.AvailableSpace(), "free space")
 
 	// create a new plot command
-	cmd := PlotCmd(plotDir.dirStr, farmDir.dirStr)
+	job := PlotJob{
+		TempDir:  plotDir.dirStr,
+		TempDir2: settings.SecondTempDir,
+		FarmDir:  farmDir.dirStr,
+		Threads:  settings.Threads,
+		MemMB:    settings.MemMB,
+		Buckets:  env.Buckets,
+		Keys:     settings.Keys(),
+	}
+	cmd := plotter.Cmd(job)
+
+	// pin the plot to cores of its own, or at least keep it off the cores reserved for the chia daemons
+	var cpus []int
+	if env.CPUPinning || env.ReservedCores > 0 {
+		n := 0
+		if env.CPUPinning {
+			n = settings.Threads
+		}
+		if cpus, err = r.cpus.Allocate(n); err != nil {
+			return err
+		}
+	}
+	if env.PinChiaDaemons {
+		pinChiaDaemons(r.daemonCPUs)
+	}
+	plotCmd := cmd
+	cmd = schedCmd(plotCmd, cpus)
 	logLn("running cmd:", cmd.String())
 
+	// the plotter output goes straight to a log file so the process does not depend on the runner staying up
+	logFile, err := newPlotLog()
+	if err != nil {
+		return err
+	}
+	logPath := plotLogPath(logFile)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	// run the plot in its own process group so signals sent to the runner don't reach it
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
 	err = cmd.Start()
+	logFile.Close()
 	if err != nil {
 		logErrLn("cmd failed!")
 		return err
@@ -86,115 +373,409 @@ func (r *Runner) plot() error {
 
 	pid := cmd.Process.Pid
 	r.activeProcesses[pid] = cmd.Process
+	if env.CPUPinning {
+		r.cpus.Claim(pid, cpus)
+	}
+
 	plotDir.AddPID(pid)
 	farmDir.AddPID(pid)
 
-	logF("[%d] now plotting. plot dir:%s farm dir:%s\n", pid, plotDir.dirStr, farmDir.dirStr)
+	// follow the plotter output to track the plot progress
+	progress := newPlotProgress(plotter)
+	progress.PlotKeys = settings.Keys()
+	tail := startLogTailer(logPath, newLineWriter(plotOutput(pid, progress, plotDir, farmDir, r.makeRoom(pid, farmDir))))
+	r.Tracker.Add(pid, progress)
+	r.lastStart = time.Now()
+	metrics.PlotsStarted.Inc(plotter.Name(), plotDir.dirStr)
+
+	// the wrappers and the shell running the chia plotter exec the plotter, so the process is recognized by
+	// the plotter arguments its command line ends with
+	r.states[pid] = PlotState{
+		PID:       pid,
+		StartTime: progress.StartTime,
+		TempDir:   plotDir.dirStr,
+		TempDir2:  settings.SecondTempDir,
+		FarmDir:   farmDir.dirStr,
+		Plotter:   plotter.Name(),
+		LogPath:   logPath,
+		Cmdline:   cmdlineString(plotCmd.Args),
+		PlotArgs:  cmdlineString(plotter.Args(job)),
+		CPUs:      cpus,
+		Threads:   settings.Threads,
+		MemMB:     settings.MemMB,
+		Buckets:   env.Buckets,
+		PlotKeys:  settings.Keys(),
+	}
+	r.saveState()
+
+	logF("[%d] now plotting. plot dir:%s farm dir:%s log:%s\n", pid, plotDir.dirStr, farmDir.dirStr, logPath)
 
-	SendEmail(fmt.Sprintf("plot process %d started", pid),
+	Notify(EventPlotStarted, pid, fmt.Sprintf("plot process %d started", pid),
 		fmt.Sprintf("new plot process %d started:\n\n" +
 			"\tCMD:\t%s\n"+
 			"\tPLOT DIR:\t%s\n" +
 			"\tFARM DIR:\t%s\n\n"+
 			"CURRENT STATUS:\n\n%s", pid, cmd.String(), plotDir.dirStr, farmDir.dirStr, r.StatusString()))
 
-	go r.waitForCmd(cmd, plotDir, farmDir)
+	go r.waitForCmd(cmd, tail, plotDir, farmDir)
 	return nil
 }
 
+//nextFarmDir returns the dir the next plot is written to, the staging dir if plots are staged or else the next
+// farm dir with space
+// staged plots still need space on the farm dirs, so the staging dir is only returned if the farm dirs have space
+// for the running plots, the plots waiting to be moved and the new plot
+func (r *Runner) nextFarmDir() (*FarmDir, error) {
+	if r.staging == nil {
+		return r.FarmPool.NextUp(nil)
+	}
+	if !r.staging.Healthy() || r.staging.FarmingSpaceAvail() <= FarmPlotSpace {
+		return nil, fmt.Errorf("%w: %s", ErrStagingFull, r.staging.dirStr)
+	}
+	avail := 0
+	for _, fd := range r.FarmPool.Dirs() {
+		if !fd.Draining() && fd.Healthy() {
+			avail += plotsAvailable(fd.FarmingSpaceAvail(), FarmPlotSpace)
+		}
+	}
+	if pending := len(r.staging.PIDs()) + r.mover.Pending(); avail <= pending {
+		return nil, ErrMaxProcessesReached
+	}
+	r.staging.used()
+	return r.staging, nil
+}
+
+//makeRoom returns the func that deletes replaceable plots from the farm dir once the plot with the given PID starts
+// copying its final plot file there, nil for plots written to the staging dir
+func (r *Runner) makeRoom(pid int, farmDir *FarmDir) func() {
+	if farmDir == nil || farmDir == r.staging {
+		return nil
+	}
+	return func() {
+		var plotID string
+		if p, ok := r.Tracker.Get(pid); ok {
+			plotID = p.Snapshot().PlotID
+		}
+		need := FarmPlotSpace.Sub(filesSize(plotTempFiles(plotID, farmDir.dirStr)))
+		need = need.Add(farmDir.writing(plotID)).Add(farmDir.movesReserved())
+		if err := r.replot.MakeRoom(farmDir, need, r.FarmPool.Dirs()); err != nil {
+			logErrF("[%d] could not make room for the plot: %v\n", pid, err)
+		}
+	}
+}
+
+//findFarmDir returns the farm dir or the staging dir with the given dir string, or nil if it is neither
+func (r *Runner) findFarmDir(dirStr string) *FarmDir {
+	if r.staging != nil && r.staging.dirStr == dirStr {
+		return r.staging
+	}
+	return r.FarmPool.Find(dirStr)
+}
+
+//saveState persists the state of all active plots
+// the caller must hold the runner lock
+func (r *Runner) saveState() {
+	states := make([]PlotState, 0, len(r.states))
+	for _, st := range r.states {
+		states = append(states, st)
+	}
+	if err := r.store.Save(states); err != nil {
+		logErrLn("could not save state:", err)
+	}
+}
+
+//adoptPlots re-attaches to the plot processes of a previous run that are still running
+// adopted processes are accounted for in their plot and farm dirs and followed until they exit
+func (r *Runner) adoptPlots() {
+	env := getEnv()
+	states, err := r.store.Load()
+	if err != nil {
+		logErrLn("could not load state:", err)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, st := range states {
+		if !plotAlive(st) {
+			logF("plot process %d from a previous run is no longer running. log: %s\n", st.PID, st.LogPath)
+			continue
+		}
+		plotter, err := newPlotter(st.Plotter)
+		if err != nil {
+			logErrF("could not adopt plot process %d: %v\n", st.PID, err)
+			continue
+		}
+		proc, err := os.FindProcess(st.PID)
+		if err != nil {
+			logErrF("could not adopt plot process %d: %v\n", st.PID, err)
+			continue
+		}
+
+		progress := newPlotProgress(plotter)
+		progress.StartTime = st.StartTime
+		progress.PlotKeys = st.PlotKeys
+
+		plotDir := r.PlotPool.Find(st.TempDir)
+		if plotDir != nil {
+			plotDir.AddPID(st.PID)
+		}
+		farmDir := r.findFarmDir(st.FarmDir)
+		if farmDir != nil {
+			farmDir.AddPID(st.PID)
+		}
+		tail := startLogTailer(st.LogPath, newLineWriter(plotOutput(st.PID, progress, plotDir, farmDir,
+			r.makeRoom(st.PID, farmDir))))
+
+		r.activeProcesses[st.PID] = proc
+		if env.CPUPinning && len(st.CPUs) > 0 {
+			r.cpus.Claim(st.PID, st.CPUs)
+		}
+		r.Tracker.Add(st.PID, progress)
+		r.states[st.PID] = st
+		logF("[%d] adopted plot process started %s. plot dir:%s farm dir:%s log:%s\n",
+			st.PID, st.StartTime.Format(time.RFC3339), st.TempDir, st.FarmDir, st.LogPath)
+
+		go r.waitForAdopted(st, tail, plotDir, farmDir)
+	}
+
+	r.saveState()
+}
+
 func (r *Runner) StatusString() string {
 	var (
-		buf                           bytes.Buffer
-		totalFrmSpace                 ByteSz
-		pltsAvail, totalFrmPlotsAvail int
-		stat                          *DiskStat
+		buf                bytes.Buffer
+		totalFrmSpace      ByteSz
+		totalFrmPlotsAvail int
 	)
 
-	farmSummary, err := FarmSummaryCmd().Output()
-	if err != nil {
-		fmt.Fprintf(&buf, "Error getting farm summary:\n%v\n", err)
+	chia := r.ChiaStatus()
+	if chia.Farm == nil {
+		fmt.Fprintf(&buf, "Error getting farm summary:\n%s\n", chia.FarmError)
 	} else {
-		buf.Write(farmSummary)
+		buf.WriteString(chia.Farm.String())
 	}
 
 	buf.WriteString("\n\n")
 	fmt.Fprintf(&buf, "Plots running:\t%d\n", len(r.activeProcesses))
+	if len(r.refusal) > 0 {
+		fmt.Fprintf(&buf, "Last plot refused:\t%s\n", r.refusal)
+	}
+	for _, p := range r.Tracker.All() {
+		fmt.Fprintf(&buf, "\t-%s\n", p)
+	}
+	buf.WriteString("\n")
 
-	for _, d := range r.FarmPool.FarmDirs {
-		stat = d.DiskStat()
-		pltsAvail = int(d.AvailableSpace() / FarmPlotSpace)
+	for _, d := range r.FarmPool.Dirs() {
+		st := d.Status()
 		fmt.Fprintf(&buf, "Farm directory %s status:\n", d.dirStr)
-		fmt.Fprintf(&buf, "\t-Total space:\t%s\n", stat.Total)
-		fmt.Fprintf(&buf, "\t-Used space:\t%s\n", stat.Used)
-		fmt.Fprintf(&buf, "\t-Free space:\t%s\n", d.AvailableSpace())
-		fmt.Fprintf(&buf, "\t-Plots available:\t%d\n\n", pltsAvail)
-		totalFrmPlotsAvail += pltsAvail
-		totalFrmSpace = totalFrmSpace.Add(d.AvailableSpace())
+		fmt.Fprintf(&buf, "\t-Health:\t%s\n", healthString(st.Health, st.HealthError))
+		fmt.Fprintf(&buf, "\t-Total space:\t%s\n", st.Total)
+		fmt.Fprintf(&buf, "\t-Used space:\t%s\n", st.Used)
+		fmt.Fprintf(&buf, "\t-Free space:\t%s\n", st.Available)
+		fmt.Fprintf(&buf, "\t-Reserved space:\t%s\n", st.Reserved)
+		if st.Replaceable > 0 {
+			fmt.Fprintf(&buf, "\t-Replaceable space:\t%s\n", st.Replaceable)
+		}
+		fmt.Fprintf(&buf, "\t-Plots available:\t%d\n\n", st.PlotsAvailable)
+		totalFrmPlotsAvail += st.PlotsAvailable
+		if free := st.Available.Add(st.Replaceable).Sub(st.Reserved); free > 0 {
+			totalFrmSpace = totalFrmSpace.Add(free)
+		}
 	}
 
-	for _, p := range r.PlotPool.PlotDirs {
-		stat = p.DiskStat()
-		pltsAvail = int(p.AvailableSpace() / TmpPlotSpace)
-		fmt.Fprintf(&buf, "Plot directory %s status:\n", p.dirStr)
-		fmt.Fprintf(&buf, "\t-Total space:\t%s\n", stat.Total)
-		fmt.Fprintf(&buf, "\t-Used space:\t%s\n", stat.Used)
-		fmt.Fprintf(&buf, "\t-Free space:\t%s\n", p.AvailableSpace())
-		fmt.Fprintf(&buf, "\t-Plots available:\t%d\n\n", pltsAvail)
+	for _, p := range r.PlotPool.Dirs() {
+		st := p.Status()
+		fmt.Fprintf(&buf, "Plot directory %s status (%s):\n", p.dirStr, p.Plotter().Name())
+		fmt.Fprintf(&buf, "\t-Health:\t%s\n", healthString(st.Health, st.HealthError))
+		fmt.Fprintf(&buf, "\t-Total space:\t%s\n", st.Total)
+		fmt.Fprintf(&buf, "\t-Used space:\t%s\n", st.Used)
+		fmt.Fprintf(&buf, "\t-Free space:\t%s\n", st.Available)
+		fmt.Fprintf(&buf, "\t-Reserved space:\t%s\n", st.Reserved)
+		fmt.Fprintf(&buf, "\t-Plots available:\t%d\n\n", st.PlotsAvailable)
+	}
+
+	if r.staging != nil {
+		st := r.staging.Status()
+		fmt.Fprintf(&buf, "Staging directory %s status:\n", r.staging.dirStr)
+		fmt.Fprintf(&buf, "\t-Health:\t%s\n", healthString(st.Health, st.HealthError))
+		fmt.Fprintf(&buf, "\t-Free space:\t%s\n", st.Available)
+		fmt.Fprintf(&buf, "\t-Reserved space:\t%s\n", st.Reserved)
+		fmt.Fprintf(&buf, "\t-Plots available:\t%d\n", st.PlotsAvailable)
+		moves := r.mover.Statuses()
+		fmt.Fprintf(&buf, "\t-Staged plots:\t%d\n", len(moves))
+		for _, m := range moves {
+			fmt.Fprintf(&buf, "\t\t-%s\n", m)
+		}
+		buf.WriteString("\n")
 	}
 
 	fmt.Fprintf(&buf, "TOTAL FARM SPACE AVAILABLE:\t%s\n", totalFrmSpace)
 	fmt.Fprintf(&buf, "TOTAL FARM PLOTS AVAILABLE:\t%d\n\n", totalFrmPlotsAvail)
 
-	walletStatus, err := WalletShowCmd().Output()
-	if err != nil {
-		fmt.Fprintf(&buf, "Error getting wallet status:\n%v\n\n", err)
+	if chia.Wallet == nil {
+		fmt.Fprintf(&buf, "Error getting wallet status:\n%s\n\n", chia.WalletError)
 	} else {
-		buf.Write(walletStatus)
+		buf.WriteString(chia.Wallet.String())
 	}
 
 	return buf.String()
 }
 
-//waitForCmd waits for an exec.Cmd to complete, then removes the PID from the plot and farm dirs and removes
-// the process from the active process slice
-func (r *Runner) waitForCmd(cmd *exec.Cmd, plotDir *PlotDir, farmDir *FarmDir) {
-	pid := cmd.Process.Pid
+//waitForCmd waits for an exec.Cmd to complete, then finishes the plot
+func (r *Runner) waitForCmd(cmd *exec.Cmd, tail *logTailer, plotDir *PlotDir, farmDir *FarmDir) {
 	err := cmd.Wait()
+	tail.Stop()
+	r.finishPlot(cmd.Process.Pid, err, plotDir, farmDir)
+}
+
+//waitForAdopted polls an adopted plot process until it exits, then finishes the plot
+// the exit status of an adopted process is unknown, so the plot failed if the plotter output never finished
+func (r *Runner) waitForAdopted(st PlotState, tail *logTailer, plotDir *PlotDir, farmDir *FarmDir) {
+	for plotAlive(st) {
+		time.Sleep(10 * time.Second)
+	}
+	tail.Stop()
+	var err error
+	if p, ok := r.Tracker.Get(st.PID); ok && p.Snapshot().Phase != PhaseDone {
+		err = fmt.Errorf("adopted process exited before the plot was done")
+	}
+	r.finishPlot(st.PID, err, plotDir, farmDir)
+}
+
+//finishPlot removes the PID from the plot and farm dirs and removes the process from the active processes
+// plotDir and farmDir may be nil for adopted processes of dirs that are no longer configured
+func (r *Runner) finishPlot(pid int, err error, plotDir *PlotDir, farmDir *FarmDir) {
+	var progress PlotProgress
+	if p, ok := r.Tracker.Get(pid); ok {
+		progress = p.Snapshot()
+	}
+	r.mu.RLock()
+	st := r.states[pid]
+	r.mu.RUnlock()
+	// the plot still counts as running while it is verified so its dirs are not handed out again
+	var check *PlotCheck
+	if err == nil && getEnv().VerifyPlots {
+		check, err = verifyPlot(pid, progress.PlotID, st.FarmDir)
+	}
 	if err != nil {
 		logF("process %d finished with error: %v\n", pid, err)
-		SendEmail(fmt.Sprintf("plot process %d finished with error code", pid),
+		cleanupPlot(pid, progress.PlotID, st.TempDir, st.TempDir2, st.FarmDir)
+		subject := fmt.Sprintf("plot process %d finished with error code", pid)
+		if errors.Is(err, ErrPlotInvalid) {
+			subject = fmt.Sprintf("plot process %d produced an invalid plot", pid)
+		}
+		Notify(EventPlotFailed, pid, subject,
 			fmt.Sprintf("plot process %d finished with error:\n%v\n\n"+
-				"CURRENT STATUS:\n\n%s", pid, err, r.StatusString()))
+				"LAST PROGRESS:\n\n%s\n%s\n"+
+				"CURRENT STATUS:\n\n%s", pid, err, progress, progress.PhaseTimesString(), r.StatusString()))
 	}
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	res := newPlotResult(progress, r.states[pid], err)
+	res.Verification = check
+	if err == nil {
+		res.PlotFile, res.PlotSize = finalPlotFile(res.PlotID, res.FarmDir)
+	}
+	r.addHistory(res)
+	if err := r.historyStore.Append(res); err != nil {
+		logErrLn("could not save the plot history:", err)
+	}
+	observePlot(res)
 	// cleanup after our process
-	plotDir.RmPID(pid)
-	farmDir.RmPID(pid)
+	if plotDir != nil {
+		plotDir.RmPID(pid)
+	}
+	if farmDir != nil {
+		farmDir.RmPID(pid)
+	}
 	delete(r.activeProcesses, pid)
-	logF("process %d finished\n", pid)
-	SendEmail(fmt.Sprintf("plot process %d finished", pid),
-		fmt.Sprintf("plot process %d finished successfully\n\nCURRENT STATUS:\n\n%s", pid, r.StatusString()))
+	delete(r.states, pid)
+	r.cpus.Release(pid)
+	// dirs removed from the config are dropped once their last plot is done
+	r.pruneDirs()
+	r.saveState()
+	r.Tracker.Remove(pid)
+	if err != nil {
+		return
+	}
+	r.mover.Wake()
+	logF("process %d finished in %s\n%s", pid, progress.Elapsed(), progress.PhaseTimesString())
+	Notify(EventPlotFinished, pid, fmt.Sprintf("plot process %d finished", pid),
+		fmt.Sprintf("plot process %d finished successfully\n\nVERIFICATION: %s\n\nPHASE TIMES:\n\n%s\n"+
+			"CURRENT STATUS:\n\n%s", pid, check, progress.PhaseTimesString(), r.StatusString()))
 }
 
 //killAll kills all the active processes
 func (r *Runner) killAll() {
+	// finishPlot removes the killed plots from the maps as their processes exit, so they are copied first
+	r.mu.RLock()
+	procs := make(map[int]*os.Process, len(r.activeProcesses))
+	states := make(map[int]PlotState, len(r.activeProcesses))
 	for pid, proc := range r.activeProcesses {
-		if err := proc.Kill(); err != nil {
+		procs[pid] = proc
+		states[pid] = r.states[pid]
+	}
+	r.mu.RUnlock()
+
+	for pid, proc := range procs {
+		// the progress of the plot is dropped as well once its process has exited
+		var plotID string
+		if p, ok := r.Tracker.Get(pid); ok {
+			plotID = p.Snapshot().PlotID
+		}
+		if err := killPlot(pid, proc); err != nil {
 			logErrLn("failed to kill plot process", pid)
 		} else {
 			logLn("killed plot process", pid)
+			st := states[pid]
+			cleanupPlot(pid, plotID, st.TempDir, st.TempDir2, st.FarmDir)
 		}
 	}
 }
 
+//KillPlot kills the plot process with the given PID
+// the plot is finished as failed once the process has exited
+func (r *Runner) KillPlot(pid int) error {
+	r.mu.RLock()
+	proc, ok := r.activeProcesses[pid]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("no active plot process %d", pid)
+	}
+	if err := killPlot(pid, proc); err != nil {
+		return err
+	}
+	logLn("killed plot process", pid)
+	return nil
+}
+
+//killPlot kills the process group of the plot process so the plotter started by the shell is killed too
+func killPlot(pid int, proc *os.Process) error {
+	if err := syscall.Kill(-pid, syscall.SIGKILL); err != nil {
+		return proc.Kill()
+	}
+	return nil
+}
+
+//canRetry returns true if the error returned by plot only means that no plot can be started right now
+func canRetry(err error) bool {
+	return err == ErrMaxProcessesReached || err == ErrPaused || errors.Is(err, ErrStaggered) ||
+		errors.Is(err, ErrNotEnoughMemory) || errors.Is(err, ErrNoFreeCPUs) || err == ErrDirsBusy ||
+		errors.Is(err, ErrStagingFull)
+}
+
 //runner is the actual worker
 func (r *Runner) runner(ctx context.Context, waitDur time.Duration) {
 	ticker := time.NewTicker(waitDur)
 
 	// first plot cmd before the for loop
-	if err := r.plot(); err != nil && err != ErrMaxProcessesReached {
-		SendEmail("plot process FAILED",
+	// the space of the replaceable plots is counted by the health checks of the farm dirs
+	r.replot.Refresh(r.FarmPool.Dirs())
+	r.checkDirHealth()
+	if err := r.plot(); err != nil && !canRetry(err) {
+		NotifySync(EventPlotFailed, 0, "plot process FAILED",
 			fmt.Sprintf("plot process FAILED\n\nCURRENT STATUS:\n\n%s", r.StatusString()))
 		logFatalLn("plot error:", err)
 		return
@@ -207,13 +788,36 @@ func (r *Runner) runner(ctx context.Context, waitDur time.Duration) {
 			r.killAll()
 			return
 		case <-ticker.C:
+			if r.Draining() {
+				active := r.Tracker.All()
+				// staged plots that are not being moved yet are moved on the next start
+				moves := r.mover.Active()
+				if len(active) == 0 && r.ActiveCnt() == 0 && moves == 0 {
+					logLn("drain complete, runner exiting...")
+					return
+				}
+				if moves > 0 {
+					logF("draining: waiting for %d plots being moved to a farm dir\n", moves)
+				}
+				logF("draining: waiting for %d running plots to finish\n", len(active))
+				for _, p := range active {
+					logLn(p)
+				}
+				continue
+			}
 			// got tick, try to plot
+			r.replot.Refresh(r.FarmPool.Dirs())
+			r.checkDirHealth()
 			err := r.plot()
-			if err == ErrMaxProcessesReached{
+			if err == ErrPaused {
+				logF("scheduling paused, %d plots running\n", r.ActiveCnt())
+			} else if err == ErrMaxProcessesReached{
 				logF("max processes reached. Will try again in %s\n", waitDur.String())
 
+			} else if err != nil && canRetry(err) {
+				logF("%v. Will try again in %s\n", err, waitDur.String())
 			} else if err != nil {
-				SendEmail("plot process FAILED to start",
+				NotifySync(EventPlotFailed, 0, "plot process FAILED to start",
 					fmt.Sprintf("plot process FAILED to start\n\nCURRENT STATUS:\n\n%s", r.StatusString()))
 				logFatalLn("plot error:", err)
 				return
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestMemoryCheck(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{
+		MaxMemoryMB:      10000,
+		PerPlotMemMB:     4000,
+		MemoryHeadroomMB: 1000,
+		MaxSwapUsedMB:    100,
+		StateFile:        t.TempDir() + "/state.json",
+	})
+
+	r := newRunner()
+	plotter, _ := newPlotter(PlotterChia)
+	plenty := &MemStats{Available: ByteSzFromMB(64000)}
+
+	tests := []struct {
+		name    string
+		running int
+		mem     *MemStats
+		ok      bool
+	}{
+		{"idle", 0, plenty, true},
+		{"below max", 1, plenty, true},
+		{"above max", 2, plenty, false},
+		{"low available", 0, &MemStats{Available: ByteSzFromMB(4500)}, false},
+		{"enough available", 0, &MemStats{Available: ByteSzFromMB(5000)}, true},
+		{"swapping", 0, &MemStats{Available: ByteSzFromMB(64000), SwapUsed: ByteSzFromMB(200)}, false},
+	}
+	for _, tt := range tests {
+		r.activeProcesses = map[int]*os.Process{}
+		r.states = map[int]PlotState{}
+		for pid := 1; pid <= tt.running; pid++ {
+			r.activeProcesses[pid] = nil
+			r.states[pid] = PlotState{PID: pid, Plotter: PlotterChia}
+		}
+		err := r.memoryCheck(plotter.Memory(), tt.mem)
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrNotEnoughMemory) {
+			t.Errorf("%s: expected ErrNotEnoughMemory, got %v", tt.name, err)
+		}
+		if !tt.ok && !canRetry(err) {
+			t.Errorf("%s: expected %v to be retryable", tt.name, err)
+		}
+	}
+}
+
+func TestSecondTempReserved(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{PerPlotMemMB: 4000, StateFile: t.TempDir() + "/state.json"})
+
+	const plotID = "3f5a1e0e2d5c9b0fbd6b0b4b3f9c8b2c6a3d8e1f0a9b7c6d5e4f3a2b1c0d9e8f"
+	shared := t.TempDir()
+	if err := os.WriteFile(shared+"/plot-k32-2021-05-12-10-00-"+plotID+".plot.2.tmp", []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := newRunner()
+	pd := newPlotDir(shared, chiaPlotter{})
+	pd.stat = fakeStats{shared: TmpPlotSpace.Add(FarmPlotSpace.Sub(1))}.stat
+	r.PlotPool.AddDirs(pd)
+	if !r.tempDirAccepts(pd) {
+		t.Errorf("expected the temp dir to accept a plot")
+	}
+
+	// a chia plot that wrote 1 B of its final plot file to the dir and a madmax plot without a plot ID yet
+	progress := newPlotProgress(chiaPlotter{})
+	progress.PlotID = plotID
+	r.Tracker.Add(1, progress)
+	r.states[1] = PlotState{PID: 1, Plotter: PlotterChia, TempDir: "/plot/a", TempDir2: shared}
+	r.states[2] = PlotState{PID: 2, Plotter: PlotterMadmax, TempDir: "/plot/b", TempDir2: shared}
+	if got, expect := r.secondTempReserved(shared), FarmPlotSpace.Sub(1).Add(MadmaxTmp2PlotSpace); got != expect {
+		t.Errorf("expected %s reserved, got %s", expect, got)
+	}
+	if r.tempDirAccepts(pd) {
+		t.Errorf("expected the temp dir to refuse a plot that needs the space reserved for second temp files")
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"golang.org/x/sys/unix"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	IONiceRealtime   = "realtime"
+	IONiceBestEffort = "best-effort"
+	IONiceIdle       = "idle"
+)
+
+var (
+	ErrNoFreeCPUs = fmt.Errorf("no free cpus")
+
+	// ioniceClasses maps the IONiceClass config values to the class numbers of ionice -c
+	ioniceClasses = map[string]int{
+		IONiceRealtime:   1,
+		IONiceBestEffort: 2,
+		IONiceIdle:       3,
+	}
+
+	// chiaDaemons are the process names of the chia services pinned to the reserved cores
+	chiaDaemons = map[string]bool{
+		"chia_daemon":    true,
+		"chia_full_node": true,
+		"chia_farmer":    true,
+		"chia_harvester": true,
+		"chia_wallet":    true,
+		"chia_timelord":  true,
+	}
+)
+
+//cpuSets returns the cores chiarunner may use, split into the first reserved cores for the chia daemons
+// and the remaining cores for plots
+func cpuSets(reserved int) ([]int, []int, error) {
+	var set unix.CPUSet
+	if err := unix.SchedGetaffinity(0, &set); err != nil {
+		return nil, nil, err
+	}
+	cores := make([]int, 0, set.Count())
+	for cpu := 0; len(cores) < set.Count(); cpu++ {
+		if set.IsSet(cpu) {
+			cores = append(cores, cpu)
+		}
+	}
+	if reserved >= len(cores) {
+		return nil, nil, fmt.Errorf("can not reserve %d of %d cores", reserved, len(cores))
+	}
+	return cores[:reserved], cores[reserved:], nil
+}
+
+//newCPUAllocator creates a new cpuAllocator handing out the given cores
+func newCPUAllocator(cores []int) *cpuAllocator {
+	return &cpuAllocator{
+		cores:    cores,
+		assigned: map[int][]int{},
+		mu:       &sync.Mutex{},
+	}
+}
+
+//cpuAllocator assigns non-overlapping sets of cores to plot processes
+type cpuAllocator struct {
+	cores    []int
+	assigned map[int][]int
+	mu       *sync.Mutex
+}
+
+//Allocate returns n cores not assigned to any plot, or all cores if n is 0
+// the cores are only assigned once they are claimed for a PID
+func (a *cpuAllocator) Allocate(n int) ([]int, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if n <= 0 {
+		return a.cores, nil
+	}
+	used := map[int]bool{}
+	for _, cpus := range a.assigned {
+		for _, cpu := range cpus {
+			used[cpu] = true
+		}
+	}
+	free := make([]int, 0, n)
+	for _, cpu := range a.cores {
+		if !used[cpu] {
+			free = append(free, cpu)
+		}
+		if len(free) == n {
+			return free, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d of %d cores are free, a new plot needs %d",
+		ErrNoFreeCPUs, len(free), len(a.cores), n)
+}
+
+//Claim assigns the given cores to the plot with the given PID
+func (a *cpuAllocator) Claim(pid int, cpus []int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.assigned[pid] = cpus
+}
+
+//Release frees the cores assigned to the plot with the given PID
+func (a *cpuAllocator) Release(pid int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.assigned, pid)
+}
+
+//cpuList formats cores as a list for taskset -c
+func cpuList(cpus []int) string {
+	strs := make([]string, len(cpus))
+	for i, cpu := range cpus {
+		strs[i] = strconv.Itoa(cpu)
+	}
+	return strings.Join(strs, ",")
+}
+
+//schedArgs returns the taskset, nice and ionice command prefix that runs a command on the given cores
+// with the configured priorities
+func schedArgs(cpus []int) []string {
+	env := getEnv()
+	var args []string
+	if len(cpus) > 0 {
+		args = append(args, "taskset", "-c", cpuList(cpus))
+	}
+	if env.Nice != 0 {
+		args = append(args, "nice", "-n", strconv.Itoa(env.Nice))
+	}
+	if class, ok := ioniceClasses[env.IONiceClass]; ok {
+		args = append(args, "ionice", "-c", strconv.Itoa(class))
+		if env.IONiceClass != IONiceIdle {
+			args = append(args, "-n", strconv.Itoa(env.IONiceLevel))
+		}
+	}
+	return args
+}
+
+//schedCmd wraps the command so it runs on the given cores with the configured priorities
+// the wrappers exec the command in the same process, so the PID and the final command line of the process
+// are the same as the command's
+func schedCmd(cmd *exec.Cmd, cpus []int) *exec.Cmd {
+	args := schedArgs(cpus)
+	if len(args) == 0 {
+		return cmd
+	}
+	wrapped := exec.Command(args[0], append(args[1:], cmd.Args...)...)
+	wrapped.Env = cmd.Env
+	wrapped.Dir = cmd.Dir
+	return wrapped
+}
+
+//pinChiaDaemons sets the affinity of all threads of the running chia daemon processes to the given cores
+func pinChiaDaemons(cpus []int) {
+	var set unix.CPUSet
+	for _, cpu := range cpus {
+		set.Set(cpu)
+	}
+	procs, _ := filepath.Glob("/proc/[0-9]*/comm")
+	for _, comm := range procs {
+		b, err := os.ReadFile(comm)
+		if err != nil || !chiaDaemons[strings.TrimSpace(string(b))] {
+			continue
+		}
+		tasks, _ := filepath.Glob(filepath.Join(filepath.Dir(comm), "task", "[0-9]*"))
+		for _, task := range tasks {
+			tid, err := strconv.Atoi(filepath.Base(task))
+			if err != nil {
+				continue
+			}
+			if err = unix.SchedSetaffinity(tid, &set); err != nil {
+				logErrF("could not pin %s thread %d: %v\n", strings.TrimSpace(string(b)), tid, err)
+			}
+		}
+	}
+}
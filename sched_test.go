@@ -0,0 +1,72 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCPUAllocator(t *testing.T) {
+	a := newCPUAllocator([]int{2, 3, 4, 5, 6})
+
+	cpus, err := a.Allocate(2)
+	if err != nil || !reflect.DeepEqual(cpus, []int{2, 3}) {
+		t.Fatalf("expected cores [2 3], got %v %v", cpus, err)
+	}
+	a.Claim(100, cpus)
+	cpus, err = a.Allocate(2)
+	if err != nil || !reflect.DeepEqual(cpus, []int{4, 5}) {
+		t.Fatalf("expected cores [4 5], got %v %v", cpus, err)
+	}
+	a.Claim(101, cpus)
+	if _, err = a.Allocate(2); !errors.Is(err, ErrNoFreeCPUs) {
+		t.Fatalf("expected ErrNoFreeCPUs, got %v", err)
+	}
+	if cpus, _ = a.Allocate(0); len(cpus) != 5 {
+		t.Errorf("expected all cores, got %v", cpus)
+	}
+	a.Release(100)
+	cpus, err = a.Allocate(2)
+	if err != nil || !reflect.DeepEqual(cpus, []int{2, 3}) {
+		t.Errorf("expected released cores [2 3], got %v %v", cpus, err)
+	}
+}
+
+func TestSchedCmd(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{Nice: 5, IONiceClass: IONiceIdle})
+
+	_, cores, err := cpuSets(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plotCmd := exec.Command("/bin/sh", "-c", "sleep 5; true")
+	cmd := schedCmd(plotCmd, cores[:1])
+	expected := []string{"taskset", "-c", cpuList(cores[:1]), "nice", "-n", "5", "ionice", "-c", "3",
+		"/bin/sh", "-c", "sleep 5; true"}
+	if !reflect.DeepEqual(cmd.Args, expected) {
+		t.Fatalf("expected args %v, got %v", expected, cmd.Args)
+	}
+
+	for _, tool := range []string{"taskset", "nice", "ionice"} {
+		if _, err = exec.LookPath(tool); err != nil {
+			t.Skip(tool, "not installed")
+		}
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+	// the wrappers exec the plot command, so the process is tracked by its command line
+	cmdline := cmdlineString(plotCmd.Args)
+	deadline := time.Now().Add(time.Second)
+	for !processAlive(cmd.Process.Pid, cmdline) {
+		if time.Now().After(deadline) {
+			t.Fatalf("process %d is not running %q", cmd.Process.Pid, cmdline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
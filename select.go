@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	SelectRoundRobin = "round-robin"
+	SelectMostFree   = "most-free"
+	SelectFillFirst  = "fill-first"
+	SelectWeighted   = "weighted"
+	SelectLRU        = "lru"
+)
+
+var (
+	ErrDirsBusy = fmt.Errorf("all dirs with space are at their max concurrent plots")
+
+	// selectStrategies are the valid values of PlotDirStrategy and FarmDirStrategy
+	selectStrategies = map[string]bool{
+		SelectRoundRobin: true,
+		SelectMostFree:   true,
+		SelectFillFirst:  true,
+		SelectWeighted:   true,
+		SelectLRU:        true,
+	}
+)
+
+//statFunc gets the disk space of the file system of a dir
+type statFunc func(dir string) (*DiskStat, error)
+
+//dirCandidate is a dir a strategy can select
+type dirCandidate struct {
+	Path string
+	// Free is the available space not reserved by running plots
+	Free     ByteSz
+	Priority int
+	LastUsed time.Time
+}
+
+//selectStrategy decides the order dirs are tried in for a new plot
+type selectStrategy interface {
+	// Order returns the indexes of the candidates in the order they are tried
+	Order(cands []dirCandidate) []int
+	// Selected is called with the index of the candidate a new plot was started with
+	Selected(cands []dirCandidate, i int)
+}
+
+//newSelectStrategy creates the strategy with the given name, round-robin is used for unknown names
+func newSelectStrategy(name string) selectStrategy {
+	switch name {
+	case SelectMostFree:
+		return mostFreeStrategy{}
+	case SelectFillFirst:
+		return fillFirstStrategy{}
+	case SelectWeighted:
+		return &weightedStrategy{current: map[string]int{}}
+	case SelectLRU:
+		return lruStrategy{}
+	}
+	return &roundRobinStrategy{}
+}
+
+//indexes returns the indexes of n candidates in order
+func indexes(n int) []int {
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	return idx
+}
+
+//roundRobinStrategy tries the dirs in turn, starting after the last selected dir
+type roundRobinStrategy struct {
+	last string
+}
+
+func (s *roundRobinStrategy) Order(cands []dirCandidate) []int {
+	start := 0
+	for i, c := range cands {
+		if c.Path == s.last {
+			start = i + 1
+			break
+		}
+	}
+	idx := make([]int, 0, len(cands))
+	for i := range cands {
+		idx = append(idx, (start+i)%len(cands))
+	}
+	return idx
+}
+
+func (s *roundRobinStrategy) Selected(cands []dirCandidate, i int) {
+	s.last = cands[i].Path
+}
+
+//mostFreeStrategy tries the dirs with the most free space first
+type mostFreeStrategy struct{}
+
+func (mostFreeStrategy) Order(cands []dirCandidate) []int {
+	idx := indexes(len(cands))
+	sort.SliceStable(idx, func(a, b int) bool {
+		return cands[idx[a]].Free > cands[idx[b]].Free
+	})
+	return idx
+}
+
+func (mostFreeStrategy) Selected([]dirCandidate, int) {}
+
+//fillFirstStrategy tries the dirs in their configured order, so a dir is filled before the next one is used
+// and the drives not written to can spin down
+type fillFirstStrategy struct{}
+
+func (fillFirstStrategy) Order(cands []dirCandidate) []int {
+	return indexes(len(cands))
+}
+
+func (fillFirstStrategy) Selected([]dirCandidate, int) {}
+
+//weightedStrategy spreads the plots over the dirs in proportion to their priority using smooth weighted round-robin
+type weightedStrategy struct {
+	current map[string]int
+}
+
+func (s *weightedStrategy) Order(cands []dirCandidate) []int {
+	idx := indexes(len(cands))
+	sort.SliceStable(idx, func(a, b int) bool {
+		ca, cb := cands[idx[a]], cands[idx[b]]
+		return s.current[ca.Path]+ca.Priority > s.current[cb.Path]+cb.Priority
+	})
+	return idx
+}
+
+func (s *weightedStrategy) Selected(cands []dirCandidate, i int) {
+	total := 0
+	current := make(map[string]int, len(cands))
+	for _, c := range cands {
+		current[c.Path] = s.current[c.Path] + c.Priority
+		total += c.Priority
+	}
+	current[cands[i].Path] -= total
+	// dirs that are gone are dropped along the way
+	s.current = current
+}
+
+//lruStrategy tries the dir that was selected least recently first
+type lruStrategy struct{}
+
+func (lruStrategy) Order(cands []dirCandidate) []int {
+	idx := indexes(len(cands))
+	sort.SliceStable(idx, func(a, b int) bool {
+		return cands[idx[a]].LastUsed.Before(cands[idx[b]].LastUsed)
+	})
+	return idx
+}
+
+func (lruStrategy) Selected([]dirCandidate, int) {}
+
+//dirKey returns the key of a per dir setting that applies to the given dir
+// the dir itself is used if it is a key, otherwise the first matching glob pattern in sorted order
+func dirKey(dir string, keys []string) (string, bool) {
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == dir {
+			return k, true
+		}
+	}
+	for _, k := range keys {
+		if ok, _ := filepath.Match(k, dir); ok {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+//dirInt returns the per dir setting of the given dir from m, or def if none applies
+func dirInt(m map[string]int, dir string, def int) int {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	if k, ok := dirKey(dir, keys); ok {
+		return m[k]
+	}
+	return def
+}
+
+//candidate returns the dir as a candidate for a strategy with the given free space
+func (d *dir) candidate(e *envVars, free ByteSz) dirCandidate {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return dirCandidate{
+		Path:     d.dirStr,
+		Free:     free,
+		Priority: dirInt(e.DirPriorities, d.dirStr, 1),
+		LastUsed: d.lastUsed,
+	}
+}
+
+//busy returns true if the dir has reached its max number of concurrent plots
+func (d *dir) busy(e *envVars) bool {
+	max := dirInt(e.DirMaxConcurrent, d.dirStr, 0)
+	return max > 0 && len(d.PIDs()) >= max
+}
+
+//used records that a new plot was started in the dir
+func (d *dir) used() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastUsed = time.Now()
+}
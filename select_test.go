@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeStats is a fake disk stat provider returning the available space of each dir
+type fakeStats map[string]ByteSz
+
+func (f fakeStats) stat(dir string) (*DiskStat, error) {
+	avail, ok := f[dir]
+	if !ok {
+		return nil, fmt.Errorf("no such dir %s", dir)
+	}
+	return &DiskStat{Available: avail, Total: avail}, nil
+}
+
+func TestFarmDirStrategies(t *testing.T) {
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+
+	stats := fakeStats{
+		"/farm/a": FarmPlotSpace * 2,
+		"/farm/b": FarmPlotSpace * 10,
+		"/farm/c": FarmPlotSpace * 5,
+	}
+	newPool := func(strategy string) *FarmPool {
+		pool := &FarmPool{mu: &sync.RWMutex{}}
+		pool.SetStrategy(strategy)
+		for _, d := range []string{"/farm/a", "/farm/b", "/farm/c"} {
+			fd := NewFarmDir(d)
+			fd.stat = stats.stat
+			pool.AddDirs(fd)
+		}
+		return pool
+	}
+	// next selects n farm dirs, each new plot reserves the space of a plot until it is done
+	next := func(pool *FarmPool, n int) []string {
+		t.Helper()
+		var out []string
+		for pid := 1; pid <= n; pid++ {
+			fd, err := pool.NextUp(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fd.AddPID(pid)
+			out = append(out, fd.dirStr)
+		}
+		return out
+	}
+
+	tests := []struct {
+		strategy string
+		env      envVars
+		expect   []string
+	}{
+		{SelectRoundRobin, envVars{}, []string{"/farm/a", "/farm/b", "/farm/c", "/farm/b", "/farm/c"}},
+		{SelectMostFree, envVars{}, []string{"/farm/b", "/farm/b", "/farm/b", "/farm/b", "/farm/b", "/farm/b"}},
+		{SelectFillFirst, envVars{}, []string{"/farm/a", "/farm/b", "/farm/b"}},
+		{SelectWeighted, envVars{DirPriorities: map[string]int{"/farm/b": 3}},
+			[]string{"/farm/b", "/farm/a", "/farm/b", "/farm/c", "/farm/b"}},
+		{SelectLRU, envVars{}, []string{"/farm/a", "/farm/b", "/farm/c", "/farm/b", "/farm/c"}},
+		{SelectMostFree, envVars{DirMaxConcurrent: map[string]int{"/farm/b": 1}},
+			[]string{"/farm/b", "/farm/c", "/farm/c", "/farm/c"}},
+	}
+	for _, tt := range tests {
+		e := tt.env
+		setEnv(&e)
+		got := next(newPool(tt.strategy), len(tt.expect))
+		if fmt.Sprint(got) != fmt.Sprint(tt.expect) {
+			t.Errorf("%s: expected %v, got %v", tt.strategy, tt.expect, got)
+		}
+	}
+
+	// a busy dir is not reported as out of space
+	setEnv(&envVars{DirMaxConcurrent: map[string]int{"/farm/*": 1}})
+	pool := newPool(SelectRoundRobin)
+	next(pool, 3)
+	if _, err := pool.NextUp(nil); err != ErrDirsBusy {
+		t.Errorf("expected %v, got %v", ErrDirsBusy, err)
+	}
+
+	// a move from the staging dir counts like a running plot
+	pool = newPool(SelectRoundRobin)
+	next(pool, 2)
+	pool.Find("/farm/c").addMove("/farm/c/plot-k32-a.plot.tmp", FarmPlotSpace)
+	if _, err := pool.NextUp(nil); err != ErrDirsBusy {
+		t.Errorf("expected %v with a move into the free dir, got %v", ErrDirsBusy, err)
+	}
+}
+
+func TestSelectStrategyOrder(t *testing.T) {
+	now := time.Now()
+	cands := []dirCandidate{
+		{Path: "a", Free: 3, Priority: 1, LastUsed: now},
+		{Path: "b", Free: 1, Priority: 1, LastUsed: now.Add(-time.Hour)},
+		{Path: "c", Free: 2, Priority: 1},
+	}
+	tests := []struct {
+		strategy string
+		expect   []int
+	}{
+		{SelectRoundRobin, []int{0, 1, 2}},
+		{SelectMostFree, []int{0, 2, 1}},
+		{SelectFillFirst, []int{0, 1, 2}},
+		{SelectWeighted, []int{0, 1, 2}},
+		{SelectLRU, []int{2, 1, 0}},
+	}
+	for _, tt := range tests {
+		s := newSelectStrategy(tt.strategy)
+		if got := s.Order(cands); fmt.Sprint(got) != fmt.Sprint(tt.expect) {
+			t.Errorf("%s: expected %v, got %v", tt.strategy, tt.expect, got)
+		}
+	}
+
+	rr := newSelectStrategy(SelectRoundRobin)
+	rr.Selected(cands, 1)
+	if got := rr.Order(cands); fmt.Sprint(got) != "[2 0 1]" {
+		t.Errorf("round-robin: expected to start after the last selected dir, got %v", got)
+	}
+}
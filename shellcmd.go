@@ -1,9 +1,9 @@
 package main
 
 import (
-	"fmt"
 	"os/exec"
 	"path"
+	"strconv"
 	"strings"
 )
 
@@ -48,23 +48,13 @@ func NewShellCmdBuilder(shell string, arg ...string) *ShellCmdBuilder {
 
 func newChiaBaseCmd() *ShellCmdBuilder {
 	cmd := NewShellCmdBuilder("/bin/bash", "-c")
-	cmd.AddCmd(exec.Command("source", path.Join(env.ChiaDir, "activate")))
+	// without a chia dir, chia is run from the PATH
+	if chiaDir := getEnv().ChiaDir; len(chiaDir) > 0 {
+		cmd.AddCmd(exec.Command("source", path.Join(chiaDir, "activate")))
+	}
 	return cmd
 }
 
-func PlotCmd(tmpDir, farmDir string) *exec.Cmd {
-	shellCmd := newChiaBaseCmd()
-	shellCmd.AddCmd(exec.Command("chia",
-		"plots",
-		"create",
-		"-k", "32",
-		"-r", fmt.Sprintf("%d", env.PerPlotThreads),
-		"-b", fmt.Sprintf("%d", env.PerPlotMemMB),
-		"-t", tmpDir,
-		"-d", farmDir))
-	return shellCmd.Cmd()
-}
-
 func WalletShowCmd() *exec.Cmd {
 	shellCmd := newChiaBaseCmd()
 	shellCmd.AddCmd(exec.Command("chia","wallet", "show"))
@@ -75,4 +65,11 @@ func FarmSummaryCmd() *exec.Cmd {
 	shellCmd := newChiaBaseCmd()
 	shellCmd.AddCmd(exec.Command("chia","farm", "summary"))
 	return shellCmd.Cmd()
-}
\ No newline at end of file
+}
+
+//PlotsCheckCmd returns the `chia plots check` command checking the plots matching file with the given number of challenges
+func PlotsCheckCmd(file string, challenges int) *exec.Cmd {
+	shellCmd := newChiaBaseCmd()
+	shellCmd.AddCmd(exec.Command("chia", "plots", "check", "-g", file, "-n", strconv.Itoa(challenges)))
+	return shellCmd.Cmd()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//PlotState is the persisted state of a single running plot process
+type PlotState struct {
+	PID       int
+	StartTime time.Time
+	TempDir   string
+	TempDir2  string
+	FarmDir   string
+	Plotter   string
+	LogPath   string
+	Cmdline   string
+	CPUs      []int `json:",omitempty"`
+	Threads   int   `json:",omitempty"`
+	MemMB     int   `json:",omitempty"`
+	Buckets   int   `json:",omitempty"`
+	// PlotArgs are the arguments of the plotter binary, which the command line of the running process ends with
+	PlotArgs string `json:",omitempty"`
+	PlotKeys
+}
+
+//newStateStore creates a new stateStore persisting to the given file
+func newStateStore(path string) *stateStore {
+	return &stateStore{
+		path: path,
+		mu:   &sync.Mutex{},
+	}
+}
+
+//stateStore persists the PlotState of all running plots to a JSON file
+type stateStore struct {
+	path string
+	mu   *sync.Mutex
+}
+
+//Load loads the persisted plot states, returning no states if the file does not exist yet
+func (s *stateStore) Load() ([]PlotState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var states []PlotState
+	if err = json.Unmarshal(b, &states); err != nil {
+		return nil, fmt.Errorf("could not parse state file %s: %v", s.path, err)
+	}
+	return states, nil
+}
+
+//Save atomically replaces the persisted plot states with the given states
+func (s *stateStore) Save(states []PlotState) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].StartTime.Before(states[j].StartTime)
+	})
+	b, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+//cmdlineString joins command args the same way they are compared against /proc/<pid>/cmdline
+func cmdlineString(args []string) string {
+	return strings.Join(args, " ")
+}
+
+//processCmdline returns the command line of the process with the given PID
+func processCmdline(pid int) (string, error) {
+	b, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if err != nil {
+		return "", err
+	}
+	return cmdlineString(strings.Split(strings.TrimRight(string(b), "\x00"), "\x00")), nil
+}
+
+//processAlive returns true if a process with the given PID is running the given command line
+// comparing the command line guards against the PID having been reused by another process
+func processAlive(pid int, cmdline string) bool {
+	if err := syscall.Kill(pid, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	cl, err := processCmdline(pid)
+	if err != nil {
+		return false
+	}
+	return cl == cmdline
+}
+
+//plotAlive returns true if the plot process of the state is still running
+// the command line of a plot process changes as it runs: the shell of the chia plotter execs the last command,
+// leaving the python interpreter running the chia script, and the wrappers applying the cpu affinity and
+// priorities exec the plotter, so the process is matched on the plotter arguments its command line ends with
+// states of older versions without the plotter arguments are matched on the full command line
+func plotAlive(st PlotState) bool {
+	if len(st.PlotArgs) == 0 {
+		return processAlive(st.PID, st.Cmdline)
+	}
+	if err := syscall.Kill(st.PID, 0); err != nil && err != syscall.EPERM {
+		return false
+	}
+	cl, err := processCmdline(st.PID)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(cl, " "+st.PlotArgs)
+}
+
+//newPlotLog creates a new log file in the plot log dir for the output of a plot process
+func newPlotLog() (*os.File, error) {
+	env := getEnv()
+	if err := os.MkdirAll(env.PlotLogDir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(env.PlotLogDir, "plot-"+time.Now().Format("20060102-150405")+"-*.log")
+}
+
+//startLogTailer starts following the log file at the given path from the beginning,
+// writing everything appended to it to w
+// what has already been written to the log is read before this returns
+func startLogTailer(path string, w io.Writer) *logTailer {
+	t := &logTailer{
+		path: path,
+		w:    w,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		logErrF("could not follow plot log %s: %v\n", t.path, err)
+		close(t.done)
+		return t
+	}
+	if _, err = io.Copy(t.w, f); err != nil {
+		logErrF("could not read plot log %s: %v\n", t.path, err)
+	}
+	go t.run(f, 2*time.Second)
+	return t
+}
+
+//logTailer follows a plot log file that is written to by a plot process
+type logTailer struct {
+	path string
+	w    io.Writer
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (t *logTailer) run(f *os.File, interval time.Duration) {
+	defer close(t.done)
+	defer f.Close()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.stop:
+			// read whatever was written after the last read
+			_, _ = io.Copy(t.w, f)
+			return
+		case <-ticker.C:
+		}
+		if _, err := io.Copy(t.w, f); err != nil {
+			logErrF("could not read plot log %s: %v\n", t.path, err)
+			return
+		}
+	}
+}
+
+//Stop stops following the log file after reading it to the end
+func (t *logTailer) Stop() {
+	select {
+	case <-t.done:
+	default:
+		close(t.stop)
+		<-t.done
+	}
+}
+
+//plotLogPath returns the absolute path of the given log file
+func plotLogPath(f *os.File) string {
+	path, err := filepath.Abs(f.Name())
+	if err != nil {
+		return f.Name()
+	}
+	return path
+}
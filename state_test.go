@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStateStore(t *testing.T) {
+	store := newStateStore(filepath.Join(t.TempDir(), "state.json"))
+
+	states, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 0 {
+		t.Fatalf("expected no states, got %d", len(states))
+	}
+
+	now := time.Now().Truncate(time.Second)
+	err = store.Save([]PlotState{
+		{PID: 2, StartTime: now, TempDir: "/tmp/b", FarmDir: "/tmp/d", Plotter: PlotterMadmax},
+		{PID: 1, StartTime: now.Add(-time.Hour), TempDir: "/tmp/a", FarmDir: "/tmp/c", Plotter: PlotterChia},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	states, err = store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != 2 || states[0].PID != 1 || states[1].PID != 2 {
+		t.Fatalf("unexpected states %+v", states)
+	}
+	if !states[1].StartTime.Equal(now) {
+		t.Errorf("expected start time %s, got %s", now, states[1].StartTime)
+	}
+}
+
+func TestProcessAlive(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skip("sleep not available:", err)
+	}
+	defer cmd.Process.Kill()
+
+	cmdline := cmdlineString(cmd.Args)
+	// give the process a moment to show up with its new command line
+	deadline := time.Now().Add(time.Second)
+	for !processAlive(cmd.Process.Pid, cmdline) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !processAlive(cmd.Process.Pid, cmdline) {
+		t.Errorf("expected process %d to be alive", cmd.Process.Pid)
+	}
+	if processAlive(cmd.Process.Pid, cmdline+" other") {
+		t.Errorf("expected process %d not to match another command line", cmd.Process.Pid)
+	}
+	if processAlive(os.Getpid(), cmdline) {
+		t.Errorf("expected test process not to match %q", cmdline)
+	}
+}
+
+func TestPlotAliveChia(t *testing.T) {
+	if _, err := os.Stat("/bin/bash"); err != nil {
+		t.Skip("bash not available:", err)
+	}
+	// a fake chia venv whose chia script, like the real one, is run by an interpreter
+	tmp := t.TempDir()
+	bin := filepath.Join(tmp, "bin")
+	if err := os.Mkdir(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, "activate"), []byte("PATH="+bin+":$PATH\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bin, "chia"), []byte("#!/bin/sh\nsleep 30\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	prevEnv := getEnv()
+	defer setEnv(prevEnv)
+	setEnv(&envVars{ChiaDir: tmp})
+
+	plotter := chiaPlotter{}
+	job := PlotJob{TempDir: filepath.Join(tmp, "temp"), FarmDir: filepath.Join(tmp, "farm"), Threads: 2, MemMB: 3400}
+	cmd := plotter.Cmd(job)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		cmd.Wait()
+	}()
+
+	st := PlotState{PID: cmd.Process.Pid, Cmdline: cmdlineString(cmd.Args), PlotArgs: cmdlineString(plotter.Args(job))}
+	// the shell execs the chia script, the process is matched on the command line of the script
+	deadline := time.Now().Add(2 * time.Second)
+	cl, _ := processCmdline(st.PID)
+	for (len(cl) == 0 || cl == st.Cmdline) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		cl, _ = processCmdline(st.PID)
+	}
+	if cl == st.Cmdline {
+		t.Logf("the shell did not exec the chia script, its command line is %q", cl)
+	}
+	if !plotAlive(st) {
+		t.Fatalf("expected the chia plot to be alive, its command line is %q", cl)
+	}
+
+	other := st
+	other.PlotArgs = cmdlineString(plotter.Args(PlotJob{TempDir: job.TempDir, FarmDir: filepath.Join(tmp, "other")}))
+	if plotAlive(other) {
+		t.Error("expected a plot with other arguments not to match")
+	}
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+const maxHistory = 100
+
+//DirStatus is the capacity status of a plot or farm dir
+type DirStatus struct {
+	Path           string
+	Plotter        string `json:",omitempty"`
+	Total          ByteSz
+	Used           ByteSz
+	Available      ByteSz
+	Reserved       ByteSz
+	PlotsAvailable int
+	ActivePIDs     []int
+	Draining       bool
+	Health         Health
+	HealthError    string `json:",omitempty"`
+	Replaceable    ByteSz `json:",omitempty"`
+}
+
+//PlotResult is the outcome of a finished plot process
+type PlotResult struct {
+	PID        int
+	PlotID     string
+	Plotter    string
+	TempDir    string
+	TempDir2   string `json:",omitempty"`
+	FarmDir    string
+	Threads    int    `json:",omitempty"`
+	MemMB      int    `json:",omitempty"`
+	Buckets    int    `json:",omitempty"`
+	Cmdline    string `json:",omitempty"`
+	StartTime  time.Time
+	EndTime    time.Time
+	ExitCode   int
+	Error      string `json:",omitempty"`
+	PhaseTimes [4]time.Duration
+	TotalTime  time.Duration
+	CopyTime   time.Duration
+	PlotFile   string `json:",omitempty"`
+	PlotSize   ByteSz `json:",omitempty"`
+	// Verification is the result of `chia plots check`, nil if the plot was not verified
+	Verification *PlotCheck `json:",omitempty"`
+	// PlotKeys are the keys the plot was created with, empty for the default keys of the plotter
+	PlotKeys
+}
+
+//RunnerStatus is a snapshot of the state of the Runner
+type RunnerStatus struct {
+	Paused           bool
+	Draining         bool
+	ActivePlots      int
+	MaxParallelPlots int
+	LastStart        time.Time
+	LastRefusal      string `json:",omitempty"`
+	Plots            []PlotProgress
+	PlotDirs         []DirStatus
+	FarmDirs         []DirStatus
+	StagingDir       *DirStatus   `json:",omitempty"`
+	Moves            []MoveStatus `json:",omitempty"`
+	Chia             ChiaStatus
+}
+
+//Status returns the capacity status of the plot dir
+func (p *PlotDir) Status() DirStatus {
+	stat := p.DiskStat()
+	reserved := p.Reserved()
+	health, reason := p.Health()
+	st := DirStatus{
+		Path:        p.dirStr,
+		Plotter:     p.Plotter().Name(),
+		Total:       stat.Total,
+		Used:        stat.Used,
+		Available:   stat.Available,
+		Reserved:    reserved,
+		ActivePIDs:  p.PIDs(),
+		Draining:    p.Draining(),
+		Health:      health,
+		HealthError: reason,
+	}
+	st.PlotsAvailable = plotsAvailable(stat.Available.Sub(reserved), p.Plotter().TempSpace())
+	return st
+}
+
+//Status returns the capacity status of the farm dir
+func (f *FarmDir) Status() DirStatus {
+	stat := f.DiskStat()
+	reserved := f.Reserved()
+	replaceable := f.Replaceable()
+	health, reason := f.Health()
+	return DirStatus{
+		Path:           f.dirStr,
+		Total:          stat.Total,
+		Used:           stat.Used,
+		Available:      stat.Available,
+		Reserved:       reserved,
+		Replaceable:    replaceable,
+		PlotsAvailable: plotsAvailable(stat.Available.Add(replaceable).Sub(reserved), FarmPlotSpace),
+		ActivePIDs:     f.PIDs(),
+		Draining:       f.Draining(),
+		Health:         health,
+		HealthError:    reason,
+	}
+}
+
+//plotsAvailable returns the number of plots of the given size that fit in the free space
+func plotsAvailable(free, size ByteSz) int {
+	if free <= 0 || size <= 0 {
+		return 0
+	}
+	return int(free / size)
+}
+
+//newPlotResult creates the PlotResult of a finished plot from its last progress and state
+func newPlotResult(progress PlotProgress, st PlotState, err error) PlotResult {
+	res := PlotResult{
+		PID:        progress.PID,
+		PlotID:     progress.PlotID,
+		Plotter:    progress.Plotter,
+		TempDir:    st.TempDir,
+		TempDir2:   st.TempDir2,
+		FarmDir:    st.FarmDir,
+		Threads:    st.Threads,
+		MemMB:      st.MemMB,
+		Buckets:    st.Buckets,
+		Cmdline:    st.Cmdline,
+		StartTime:  progress.StartTime,
+		EndTime:    time.Now(),
+		PhaseTimes: progress.PhaseTimes,
+		TotalTime:  progress.TotalTime,
+		CopyTime:   progress.CopyTime,
+		PlotKeys:   st.PlotKeys,
+	}
+	if err != nil {
+		res.Error = err.Error()
+		// the exit code is unknown if the process did not exit on its own or was adopted
+		res.ExitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			res.ExitCode = exitErr.ExitCode()
+		} else if errors.Is(err, ErrPlotInvalid) {
+			// the plotter exited successfully, its plot failed the verification
+			res.ExitCode = 0
+		}
+	}
+	return res
+}
+
+//addHistory adds a finished plot to the history of recently finished plots
+// the caller must hold the runner lock
+func (r *Runner) addHistory(res PlotResult) {
+	r.history = append(r.history, res)
+	if len(r.history) > maxHistory {
+		r.history = r.history[len(r.history)-maxHistory:]
+	}
+}
+
+//plotMoved points the history records of a staged plot to the farm dir the mover moved it to
+func (r *Runner) plotMoved(src, dst string) {
+	update := func(res *PlotResult) {
+		res.PlotFile, res.FarmDir = dst, filepath.Dir(dst)
+	}
+	r.mu.Lock()
+	for i := range r.history {
+		if r.history[i].PlotFile == src {
+			update(&r.history[i])
+		}
+	}
+	r.mu.Unlock()
+	if err := r.historyStore.Update(src, update); err != nil {
+		logErrLn("could not update the plot history:", err)
+	}
+}
+
+//History returns the recently finished plots, oldest first
+func (r *Runner) History() []PlotResult {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make([]PlotResult, len(r.history))
+	copy(out, r.history)
+	return out
+}
+
+//Status returns a snapshot of the runner state
+func (r *Runner) Status() RunnerStatus {
+	r.mu.RLock()
+	st := RunnerStatus{
+		Paused:           r.paused,
+		Draining:         r.draining,
+		ActivePlots:      len(r.activeProcesses),
+		MaxParallelPlots: getEnv().MaxParallelPlots,
+		LastStart:        r.lastStart,
+		LastRefusal:      r.refusal,
+	}
+	r.mu.RUnlock()
+
+	st.Plots = r.Tracker.All()
+	for _, p := range r.PlotPool.Dirs() {
+		st.PlotDirs = append(st.PlotDirs, p.Status())
+	}
+	for _, f := range r.FarmPool.Dirs() {
+		st.FarmDirs = append(st.FarmDirs, f.Status())
+	}
+	if r.staging != nil {
+		staging := r.staging.Status()
+		st.StagingDir = &staging
+	}
+	st.Moves = r.mover.Statuses()
+	st.Chia = r.ChiaStatus()
+	return st
+}
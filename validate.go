@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+//configErrors is the list of all problems found in a config
+type configErrors []string
+
+func (c configErrors) Error() string {
+	if len(c) == 1 {
+		return "invalid config: " + c[0]
+	}
+	return fmt.Sprintf("invalid config, %d problems:\n\t-%s", len(c), strings.Join(c, "\n\t-"))
+}
+
+//add adds a problem to the list
+func (c *configErrors) add(format string, v ...interface{}) {
+	*c = append(*c, fmt.Sprintf(format, v...))
+}
+
+//checkDir returns an error if the dir does not exist or is not writable
+func checkDir(dir string) error {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	f, err := os.CreateTemp(dir, ".chiarunner-probe-*")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+//deviceID returns the ID of the device the file system of the given dir is on
+func deviceID(dir string) (uint64, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("no device ID for %s", dir)
+	}
+	return uint64(st.Dev), nil
+}
+
+//tempFilesSize returns the total size of the plot temp files in the given dir
+// these are freed once the plots they belong to are done, so they count as available space
+func tempFilesSize(dir string) ByteSz {
+	return filesSize(staleTempFiles(nil, dir))
+}
+
+//emailConfigured returns true if any notification is sent by email
+func emailConfigured(e *envVars) bool {
+	if len(e.SMTPHost) > 0 || len(e.EmailTo) > 0 {
+		return true
+	}
+	for _, names := range e.Notify.Routes {
+		for _, name := range names {
+			if name == NotifierEmail {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//checkEnv checks the env against the system it runs on and returns all problems found
+// running is the env in use on a reload, its dirs that can not be reached anymore are no problem: they are kept
+// and the health checks mark them offline until their drives return
+func checkEnv(e *envVars, running *envVars) configErrors {
+	var errs configErrors
+	inUse := map[string]bool{}
+	if running != nil {
+		for _, d := range append(append(discoverPlotDirs(running), secondTempDirs(running)...), discoverFarmDirs(running)...) {
+			inUse[d] = true
+		}
+		if len(running.StagingDir) > 0 {
+			inUse[running.StagingDir] = true
+		}
+	}
+
+	if len(e.ChiaDir) > 0 {
+		if _, err := os.Stat(filepath.Join(e.ChiaDir, "activate")); err != nil {
+			errs.add("chia activate script not found: %v", err)
+		}
+	} else if len(chiaInstall(e)) == 0 {
+		errs.add("no chia install found, set ChiaDir or put chia on the PATH")
+	}
+
+	plotDirs := discoverPlotDirs(e)
+	farmDirs := discoverFarmDirs(e)
+	if len(plotDirs) == 0 {
+		errs.add("no PlotDirs configured or found")
+	}
+	// with mount scanning farm drives may show up later
+	if len(farmDirs) == 0 && !e.MountScan.Enabled() {
+		errs.add("no FarmDirs configured or found")
+	}
+	if e.MaxParallelPlots < 1 {
+		errs.add("MaxParallelPlots is %d, set MaxMemoryMB or MaxParallelPlots", e.MaxParallelPlots)
+	}
+
+	tempDevs := map[uint64]string{}
+	tempDirs := append(append([]string{}, plotDirs...), secondTempDirs(e)...)
+	for i, d := range tempDirs {
+		if err := checkDir(d); err != nil {
+			if !inUse[d] {
+				errs.add("temp dir %s: %v", d, err)
+			}
+			continue
+		}
+		if dev, err := deviceID(d); err == nil {
+			tempDevs[dev] = d
+		}
+		if i >= len(plotDirs) {
+			// the second temp dirs are shared by plots of several dirs, their space is not checked per plotter
+			continue
+		}
+		plotter, err := newPlotter(plotterName(e, d))
+		if err != nil {
+			continue
+		}
+		stat, err := statFS(d)
+		if err != nil {
+			errs.add("temp dir %s: %v", d, err)
+		} else if avail := stat.Available.Add(tempFilesSize(d)); avail < plotter.TempSpace() {
+			errs.add("temp dir %s has %s available, a %s plot needs %s",
+				d, avail, plotter.Name(), plotter.TempSpace())
+		}
+	}
+
+	for _, d := range farmDirs {
+		if err := checkDir(d); err != nil {
+			if !inUse[d] {
+				errs.add("farm dir %s: %v", d, err)
+			}
+			continue
+		}
+		if e.AllowSameFilesystem {
+			continue
+		}
+		if dev, err := deviceID(d); err == nil {
+			if tmp, ok := tempDevs[dev]; ok {
+				errs.add("farm dir %s is on the same file system as temp dir %s, set AllowSameFilesystem to allow it",
+					d, tmp)
+			}
+		}
+	}
+
+	if len(e.StagingDir) > 0 {
+		if err := checkDir(e.StagingDir); err != nil && !inUse[e.StagingDir] {
+			errs.add("staging dir %s: %v", e.StagingDir, err)
+		}
+		for _, d := range farmDirs {
+			if d == e.StagingDir {
+				errs.add("staging dir %s is also a farm dir", d)
+			}
+		}
+	}
+
+	if emailConfigured(e) {
+		if len(e.SMTPHost) == 0 {
+			errs.add("email is configured but SMTPHost is not set")
+		}
+		if e.SMTPPort <= 0 {
+			errs.add("email is configured but SMTPPort is not set")
+		}
+		if len(e.EmailFrom) == 0 {
+			errs.add("email is configured but EmailFrom is not set")
+		}
+		if len(e.EmailTo) == 0 {
+			errs.add("email is configured but EmailTo is not set")
+		}
+		if len(e.SMTPUser) > 0 && len(e.SMTPPassword) == 0 {
+			errs.add("SMTPUser is set but SMTPPassword is not")
+		}
+	}
+
+	return errs
+}
+
+//validate reads and checks the config, printing all problems found
+// it returns the exit code of the validate command
+func validate() int {
+	e, err := readEnv(nil)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("config OK\n"+
+		"\tchia:\t%s\n"+
+		"\tplot dirs:\t%s\n"+
+		"\tfarm dirs:\t%s\n"+
+		"\tplotter:\t%s\n"+
+		"\tmax parallel plots:\t%d\n",
+		chiaInstall(e), strings.Join(discoverPlotDirs(e), ", "), strings.Join(discoverFarmDirs(e), ", "), e.Plotter, e.MaxParallelPlots)
+	return 0
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadEnvValidation(t *testing.T) {
+	tmp := t.TempDir()
+	prevConfigFile := flagConfigFile
+	defer func() { flagConfigFile = prevConfigFile }()
+	flagConfigFile = filepath.Join(tmp, "config.toml")
+
+	config := `PlotDirs = ["` + filepath.Join(tmp, "missing") + `"]
+FarmDirs = []
+Plotter = "unknown"
+StaleTempPolicy = "sometimes"
+SMTPHost = "smtp.example.com"
+MaxParalelPlots = 2
+
+[Notify.Routes]
+plot_faild = ["log"]
+`
+	if err := os.WriteFile(flagConfigFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := readEnv(nil)
+	errs, ok := err.(configErrors)
+	if !ok {
+		t.Fatalf("expected configErrors, got %v", err)
+	}
+	expected := []string{
+		"unknown config key MaxParalelPlots",
+		`unknown plotter "unknown"`,
+		`invalid StaleTempPolicy "sometimes"`,
+		"no chia install found",
+		"no FarmDirs configured or found",
+		"MaxParallelPlots is 0",
+		"temp dir " + filepath.Join(tmp, "missing"),
+		"SMTPPort is not set",
+		"EmailFrom is not set",
+		"EmailTo is not set",
+		`unknown event "plot_faild"`,
+	}
+	for _, exp := range expected {
+		found := false
+		for _, e := range errs {
+			found = found || strings.Contains(e, exp)
+		}
+		if !found {
+			t.Errorf("expected a problem containing %q in:\n%v", exp, err)
+		}
+	}
+
+	config = testConfig(t, tmp, "plot", "farm") + `MaxParallelPlots = 1
+PlotDirs = ["` + filepath.Join(tmp, "plot") + `"]
+FarmDirs = ["` + filepath.Join(tmp, "farm") + `"]
+`
+	if err = os.WriteFile(flagConfigFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readEnv(nil); err != nil {
+		t.Errorf("unexpected error for a valid config: %v", err)
+	}
+
+	config = strings.Replace(config, "AllowSameFilesystem = true", "AllowSameFilesystem = false", 1)
+	if err = os.WriteFile(flagConfigFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = readEnv(nil); err == nil || !strings.Contains(err.Error(), "same file system") {
+		t.Errorf("expected farm and temp dir on the same file system to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+const defaultVerifyChallenges = 30
+
+var (
+	reCheckTesting = regexp.MustCompile(`Testing plot (\S+)`)
+	reCheckProofs  = regexp.MustCompile(`Proofs (\d+) / (\d+)`)
+	reCheckValid   = regexp.MustCompile(`Found (\d+) valid plots`)
+	reCheckInvalid = regexp.MustCompile(`(\d+) invalid plots found`)
+
+	// ErrPlotInvalid is the error of a plot process that exited successfully but whose plot failed the verification
+	ErrPlotInvalid = fmt.Errorf("plot failed verification")
+)
+
+//PlotCheck is the result of checking a finished plot with `chia plots check`
+type PlotCheck struct {
+	Challenges int
+	Proofs     int
+	Valid      bool
+	// Quarantined is where an invalid plot was moved to
+	Quarantined string `json:",omitempty"`
+	// Error is why the plot is invalid or why it could not be checked
+	Error string `json:",omitempty"`
+}
+
+//String returns the proofs found and the validity of the plot
+func (c *PlotCheck) String() string {
+	if c == nil {
+		return "not verified"
+	}
+	s := fmt.Sprintf("%d / %d proofs", c.Proofs, c.Challenges)
+	if !c.Valid {
+		s += ", invalid"
+	}
+	if len(c.Error) > 0 {
+		s += ": " + c.Error
+	}
+	return s
+}
+
+//parsePlotsCheck parses the output of `chia plots check` for a single plot
+// an error is returned if chia did not test the plot, like when its dir is not in the chia config
+func parsePlotsCheck(out []byte) (*PlotCheck, error) {
+	var (
+		c                 PlotCheck
+		tested            bool
+		valid, invalid    int
+		foundProofs       bool
+		foundValidSummary bool
+	)
+	sc := bufio.NewScanner(bytes.NewReader(out))
+	for sc.Scan() {
+		line := sc.Text()
+		if reCheckTesting.MatchString(line) {
+			tested = true
+		}
+		if m := reCheckProofs.FindStringSubmatch(line); m != nil {
+			c.Proofs, _ = strconv.Atoi(m[1])
+			c.Challenges, _ = strconv.Atoi(m[2])
+			foundProofs = true
+		}
+		if m := reCheckValid.FindStringSubmatch(line); m != nil {
+			valid, _ = strconv.Atoi(m[1])
+			foundValidSummary = true
+		}
+		if m := reCheckInvalid.FindStringSubmatch(line); m != nil {
+			invalid, _ = strconv.Atoi(m[1])
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	switch {
+	case invalid > 0:
+		// chia could not open the plot at all
+		c.Error = "chia reported the plot as invalid"
+	case !tested || !foundValidSummary:
+		return nil, fmt.Errorf("the plot was not tested, is its farm dir in the chia config?")
+	case !foundProofs:
+		c.Error = "no proofs found"
+	case valid == 0:
+		c.Error = "chia found no valid plot"
+	default:
+		c.Valid = true
+	}
+	return &c, nil
+}
+
+//checkPlot runs `chia plots check` on the plot file
+// the plot is invalid if it has less than minProofPercent proofs of the challenges
+func checkPlot(file string, challenges, minProofPercent int) (*PlotCheck, error) {
+	// chia logs to stderr
+	out, err := PlotsCheckCmd(filepath.Base(file), challenges).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("chia plots check failed: %w\n%s", err, out)
+	}
+	c, err := parsePlotsCheck(out)
+	if err != nil {
+		return nil, err
+	}
+	if c.Valid && c.Proofs*100 < c.Challenges*minProofPercent {
+		c.Valid = false
+		c.Error = fmt.Sprintf("less than %d%% of the challenges have proofs", minProofPercent)
+	}
+	return c, nil
+}
+
+//quarantinePlot moves an invalid plot to the quarantine dir so it is no longer farmed
+// without a quarantine dir, or if the plot can not be moved there, it is renamed to .bad in its dir
+func quarantinePlot(file, dir string) (string, error) {
+	if len(dir) > 0 {
+		dst := filepath.Join(dir, filepath.Base(file))
+		err := os.MkdirAll(dir, 0755)
+		if err == nil {
+			// a rename to another file system fails, copying a whole plot is not worth it for a bad plot
+			if err = os.Rename(file, dst); err == nil {
+				return dst, nil
+			}
+		}
+		logErrF("could not move %s to the quarantine dir %s: %v\n", file, dir, err)
+	}
+	dst := file + ".bad"
+	return dst, os.Rename(file, dst)
+}
+
+//verifyPlot checks the finished plot with the given ID in the farm dir and quarantines it if it is invalid
+// the returned error wraps ErrPlotInvalid if the plot is invalid, a plot that could not be checked is accepted
+func verifyPlot(pid int, plotID, farmDir string) (*PlotCheck, error) {
+	env := getEnv()
+	if len(plotID) == 0 {
+		logErrF("[%d] plot id unknown, the plot can not be verified\n", pid)
+		return nil, nil
+	}
+	file, _ := finalPlotFile(plotID, farmDir)
+	if len(file) == 0 {
+		return &PlotCheck{Error: "plot file not found"},
+			fmt.Errorf("%w: plot %s not found in %s", ErrPlotInvalid, plotID, farmDir)
+	}
+	logF("[%d] verifying %s with %d challenges\n", pid, file, env.VerifyChallenges)
+	c, err := checkPlot(file, env.VerifyChallenges, env.VerifyMinProofPercent)
+	if err != nil {
+		logErrF("[%d] could not verify %s: %v\n", pid, file, err)
+		return &PlotCheck{Challenges: env.VerifyChallenges, Error: err.Error()}, nil
+	}
+	if c.Valid {
+		logF("[%d] verified %s: %s\n", pid, file, c)
+		return c, nil
+	}
+	dst, err := quarantinePlot(file, env.QuarantineDir)
+	if err != nil {
+		logErrF("[%d] could not quarantine %s: %v\n", pid, file, err)
+		return c, fmt.Errorf("%w: %s, the plot could not be quarantined: %v", ErrPlotInvalid, c, err)
+	}
+	c.Quarantined = dst
+	return c, fmt.Errorf("%w: %s, moved to %s", ErrPlotInvalid, c, dst)
+}
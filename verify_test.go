@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParsePlotsCheck(t *testing.T) {
+	tests := []struct {
+		file       string
+		proofs     int
+		challenges int
+		valid      bool
+		err        bool
+	}{
+		{"testdata/plots_check_valid.txt", 31, 30, true, false},
+		{"testdata/plots_check_invalid.txt", 4, 30, true, false},
+		{"testdata/plots_check_corrupt.txt", 0, 0, false, false},
+		{"testdata/plots_check_not_found.txt", 0, 0, false, true},
+	}
+	for _, tt := range tests {
+		b, err := os.ReadFile(tt.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := parsePlotsCheck(b)
+		if tt.err {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.file)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if c.Proofs != tt.proofs || c.Challenges != tt.challenges || c.Valid != tt.valid {
+			t.Errorf("%s: expected %d / %d proofs valid %v, got %s", tt.file, tt.proofs, tt.challenges, tt.valid, c)
+		}
+	}
+}
+
+func TestQuarantinePlot(t *testing.T) {
+	tmp := t.TempDir()
+	plot := filepath.Join(tmp, "plot-k32-2021-06-01-08-00-abcdef.plot")
+	if err := os.WriteFile(plot, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	quarantine := filepath.Join(tmp, "quarantine")
+	dst, err := quarantinePlot(plot, quarantine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dst != filepath.Join(quarantine, filepath.Base(plot)) {
+		t.Errorf("expected the plot in the quarantine dir, got %s", dst)
+	}
+
+	// without a quarantine dir the plot is renamed so it is no longer farmed
+	if dst, err = quarantinePlot(dst, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(quarantine, filepath.Base(plot)+".bad")); err != nil {
+		t.Errorf("expected the plot renamed to .bad, got %s: %v", dst, err)
+	}
+}